@@ -0,0 +1,384 @@
+// Package amoeba lets Go programs embed the Amoeba interpreter, running
+// source code against a persistent set of globals and exchanging values
+// with the host as plain Go types
+package amoeba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+)
+
+// Func is the signature for host functions registered with RegisterFunc,
+// arguments and the return value are converted the same way as Get and Set
+type Func func(args ...interface{}) (interface{}, error)
+
+// Interpreter runs Amoeba source code, keeping the bindings
+// it creates around between runs
+type Interpreter struct {
+	env  *object.Environment
+	opts evaluator.Options
+}
+
+// NewInterpreter creates an Interpreter with an empty global environment,
+// files it imports are only run once, and aren't shared with any other
+func NewInterpreter() *Interpreter {
+	return &Interpreter{
+		env:  object.NewEnvironment(),
+		opts: evaluator.Options{Modules: evaluator.NewModules()},
+	}
+}
+
+// ParseError is returned when source code has syntax errors
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parser errors:\n\t" + strings.Join(e.Errors, "\n\t")
+}
+
+// ErrNotDefined is returned by Get for names that have no global
+var ErrNotDefined = errors.New("not defined")
+
+// RuntimeError is returned when evaluating source code produces an error
+type RuntimeError struct {
+	Err *object.Error
+}
+
+func (e *RuntimeError) Error() string { return e.Err.Inspect() }
+
+// SetLimits bounds every later run, a run that trips a limit returns a
+// *RuntimeError whose Err has its Limit set
+func (i *Interpreter) SetLimits(limits evaluator.Limits) {
+	i.opts.Limits = limits
+}
+
+// SetOutput makes print and amoeba write to out in every later run,
+// instead of os.Stdout
+func (i *Interpreter) SetOutput(out io.Writer) {
+	i.opts.Out = out
+}
+
+// SetCheckedArithmetic makes integer arithmetic that overflows an int64
+// fail with a *RuntimeError in every later run, instead of wrapping around
+func (i *Interpreter) SetCheckedArithmetic(checked bool) {
+	i.opts.CheckedArithmetic = checked
+}
+
+// Run evaluates source code and returns the value of
+// the last statement converted to a Go value
+func (i *Interpreter) Run(source string) (interface{}, error) {
+	return i.RunContext(context.Background(), source)
+}
+
+// RunContext is like Run, but stops the program once ctx is done
+func (i *Interpreter) RunContext(ctx context.Context, source string) (interface{}, error) {
+	result, err := i.eval(ctx, lexer.New(source))
+	if err != nil {
+		return nil, err
+	}
+	return ToGo(result)
+}
+
+// RunFile evaluates the file at path, using the path in error positions
+func (i *Interpreter) RunFile(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := i.eval(context.Background(), lexer.NewWithFilename(string(data), path))
+	if err != nil {
+		return nil, err
+	}
+	return ToGo(result)
+}
+
+// Eval evaluates source code and returns the value of the last
+// statement as an object, for hosts that need to keep functions
+// or other values that have no Go equivalent
+func (i *Interpreter) Eval(source string) (object.Object, error) {
+	return i.eval(context.Background(), lexer.New(source))
+}
+
+func (i *Interpreter) eval(ctx context.Context, l *lexer.Lexer) (result object.Object, err error) {
+	program, err := parse(l)
+	if err != nil {
+		return nil, err
+	}
+
+	// a bug in the interpreter mustn't take the host program down with it
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("amoeba: internal error: %v", r)
+		}
+	}()
+
+	result = evaluator.EvalWithOptions(ctx, program, i.env, i.opts)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Err: errObj}
+	}
+
+	return result, nil
+}
+
+func parse(l *lexer.Lexer) (*ast.Program, error) {
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	return program, nil
+}
+
+// Set binds a global name to a Go value, which is converted with FromGo
+func (i *Interpreter) Set(name string, value interface{}) error {
+	obj, err := FromGo(value)
+	if err != nil {
+		return err
+	}
+
+	i.env.Set(name, obj)
+	return nil
+}
+
+// Get returns the global bound to name converted with ToGo, or an
+// error wrapping ErrNotDefined when there is no such global
+func (i *Interpreter) Get(name string) (interface{}, error) {
+	obj, ok := i.env.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%q is %w", name, ErrNotDefined)
+	}
+	return ToGo(obj)
+}
+
+// RegisterBuiltin makes fn callable from Amoeba code as name, only
+// in this interpreter, shadowing any builtin with the same name
+func (i *Interpreter) RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	i.env.Set(name, &object.Builtin{Fn: fn})
+}
+
+// RegisterFunc makes a Go function callable from Amoeba code as name,
+// converting its arguments and result, errors it returns become Amoeba errors
+func (i *Interpreter) RegisterFunc(name string, fn Func) {
+	i.env.Set(name, wrapFunc(name, fn))
+}
+
+func wrapFunc(name string, fn Func) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			goArgs := make([]interface{}, len(args))
+			for idx, arg := range args {
+				goArg, err := ToGo(arg)
+				if err != nil {
+					return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+				}
+				goArgs[idx] = goArg
+			}
+
+			result, err := fn(goArgs...)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+			}
+
+			obj, err := FromGo(result)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+			}
+
+			return obj
+		},
+	}
+}
+
+// ToGo converts an object to the equivalent Go value: int64, float64,
+// bool, string, nil, []interface{} or map[interface{}]interface{}.
+// Objects with no Go equivalent, like functions, are returned as they
+// are. Arrays and hashes that contain themselves can't be converted
+func ToGo(obj object.Object) (interface{}, error) {
+	return toGo(obj, nil)
+}
+
+// toGo converts obj, which is inside of the arrays and hashes in
+// parents, finding the ones that contain themselves
+func toGo(obj object.Object, parents []object.Object) (interface{}, error) {
+	switch obj.(type) {
+	case *object.Array, *object.Hash:
+		for _, parent := range parents {
+			if parent == obj {
+				return nil, fmt.Errorf("cannot convert %s that contains itself", obj.Type())
+			}
+		}
+		parents = append(parents, obj)
+	}
+
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		values := make([]interface{}, len(obj.Elements))
+		for idx, el := range obj.Elements {
+			value, err := toGo(el, parents)
+			if err != nil {
+				return nil, err
+			}
+			values[idx] = value
+		}
+		return values, nil
+	case *object.Hash:
+		values := make(map[interface{}]interface{}, len(obj.Keys))
+		for _, pair := range obj.Ordered() {
+			key, err := toGo(pair.Key, parents)
+			if err != nil {
+				return nil, err
+			}
+			value, err := toGo(pair.Value, parents)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+		}
+		return values, nil
+	default:
+		return obj, nil
+	}
+}
+
+// FromGo converts a Go value to the equivalent object, accepting any
+// integer or float type, with unsigned ones no bigger than an int64, bool, string, nil, slices and maps of those,
+// functions matching Func or object.BuiltinFunction, and objects themselves
+func FromGo(value interface{}) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return evaluator.NULL, nil
+	case object.Object:
+		return value, nil
+	case int:
+		return &object.Integer{Value: int64(value)}, nil
+	case int8:
+		return &object.Integer{Value: int64(value)}, nil
+	case int16:
+		return &object.Integer{Value: int64(value)}, nil
+	case int32:
+		return &object.Integer{Value: int64(value)}, nil
+	case int64:
+		return &object.Integer{Value: value}, nil
+	case uint8:
+		return &object.Integer{Value: int64(value)}, nil
+	case uint16:
+		return &object.Integer{Value: int64(value)}, nil
+	case uint32:
+		return &object.Integer{Value: int64(value)}, nil
+	case uint:
+		return fromUint(uint64(value))
+	case uint64:
+		return fromUint(value)
+	case uintptr:
+		return fromUint(uint64(value))
+	case float32:
+		return &object.Float{Value: float64(value)}, nil
+	case float64:
+		return &object.Float{Value: value}, nil
+	case bool:
+		if value {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case string:
+		return &object.String{Value: value}, nil
+	case []interface{}:
+		elements := make([]object.Object, len(value))
+		for idx, el := range value {
+			obj, err := FromGo(el)
+			if err != nil {
+				return nil, err
+			}
+			elements[idx] = obj
+		}
+		return &object.Array{Elements: elements}, nil
+	case map[string]interface{}:
+		// go maps have no order, so sort the keys to keep the hash deterministic
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		hash := object.NewHash()
+		for _, key := range keys {
+			obj, err := FromGo(value[key])
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&object.String{Value: key}, obj)
+		}
+		return hash, nil
+	case map[interface{}]interface{}:
+		keys := make([]interface{}, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(a, b int) bool {
+			return fmt.Sprint(keys[a]) < fmt.Sprint(keys[b])
+		})
+
+		hash := object.NewHash()
+		for _, key := range keys {
+			el := value[key]
+			keyObj, err := FromGo(key)
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := keyObj.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("invalid hash key: %s", keyObj.Type())
+			}
+			obj, err := FromGo(el)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(hashKey, obj)
+		}
+		return hash, nil
+	case func(args ...object.Object) object.Object:
+		return &object.Builtin{Fn: value}, nil
+	case object.BuiltinFunction:
+		return &object.Builtin{Fn: value}, nil
+	case Func:
+		return wrapFunc("host function", value), nil
+	case func(args ...interface{}) (interface{}, error):
+		return wrapFunc("host function", value), nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to an amoeba object", value)
+	}
+}
+
+// fromUint converts an unsigned integer, which can be too big for an integer
+func fromUint(value uint64) (object.Object, error) {
+	if value > math.MaxInt64 {
+		return nil, fmt.Errorf("cannot convert %d to an amoeba integer, the most it can hold is %d", value, int64(math.MaxInt64))
+	}
+	return &object.Integer{Value: int64(value)}, nil
+}
@@ -0,0 +1,383 @@
+package amoeba
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{"7 / 2.0", 3.5},
+		{"1 < 2", true},
+		{`"hello" + " world"`, "hello world"},
+		{"if (false) { 1 }", nil},
+		{"let x = 4;", nil},
+		{`[1, "two", [true]]`, []interface{}{int64(1), "two", []interface{}{true}}},
+		{`{"a": 1, 2: false}`, map[interface{}]interface{}{"a": int64(1), int64(2): false}},
+	}
+
+	for _, test := range tests {
+		interp := NewInterpreter()
+
+		result, err := interp.Run(test.input)
+		if err != nil {
+			t.Errorf("Run(%q) returned error: %s", test.input, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Run(%q) wrong. expected=%#v, got=%#v", test.input, test.expected, result)
+		}
+	}
+}
+
+func TestRunKeepsGlobals(t *testing.T) {
+	interp := NewInterpreter()
+
+	if _, err := interp.Run("let total = 10; let add = fn(x) { total += x };"); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	if _, err := interp.Run("add(5)"); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	total, err := interp.Get("total")
+	if err != nil {
+		t.Fatalf("Get returned error: %s", err)
+	}
+
+	if total != int64(15) {
+		t.Errorf("total wrong. expected=15, got=%#v", total)
+	}
+
+	if _, err := interp.Get("missing"); !errors.Is(err, ErrNotDefined) {
+		t.Errorf("expected ErrNotDefined for global 'missing', got=%v", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	interp := NewInterpreter()
+
+	_, err := interp.Run("let = 5")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected *ParseError, got=%T (%v)", err, err)
+	}
+	if len(parseErr.Errors) == 0 || parseErr.Errors[0] != "1:5: expected '=' to be IDENT, got = instead" {
+		t.Errorf("parseErr.Errors wrong, got=%q", parseErr.Errors)
+	}
+
+	_, err = interp.Run("1 + true")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("runtimeErr.Err.Message wrong, got=%q", runtimeErr.Err.Message)
+	}
+	if err.Error() != "ERROR: 1:3: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("err.Error() wrong, got=%q", err.Error())
+	}
+}
+
+func TestRunDoesNotCrash(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[0] = a; a", "cannot convert ARRAY that contains itself"},
+		{`let h = {}; h["h"] = [h]; h`, "cannot convert HASH that contains itself"},
+		{"let f = fn(x) { x }; f()", "ERROR: 1:23: wrong number of arguments: want=1, got=0"},
+		{"boom()", "amoeba: internal error: boom"},
+		{
+			"let f = fn() { 1 + f() }; f()",
+			"ERROR: 1:21: call depth limit exceeded: more than 10000 nested calls\n" +
+				"    in f, called at 1:20\n    ... repeated 9998 more times\n    in f, called at 1:27",
+		},
+	}
+
+	for _, test := range tests {
+		interp := NewInterpreter()
+		interp.RegisterBuiltin("boom", func(args ...object.Object) object.Object {
+			panic("boom")
+		})
+
+		_, err := interp.Run(test.input)
+		if err == nil {
+			t.Errorf("Run(%q) returned no error", test.input)
+			continue
+		}
+		if err.Error() != test.expected {
+			t.Errorf("Run(%q) error wrong. expected=%q, got=%q", test.input, test.expected, err.Error())
+		}
+	}
+
+	// the same array twice isn't a cycle
+	interp := NewInterpreter()
+	result, err := interp.Run("let a = [1]; [a, a]")
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	expected := []interface{}{[]interface{}{int64(1)}, []interface{}{int64(1)}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("result wrong. expected=%#v, got=%#v", expected, result)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	var out bytes.Buffer
+	interp := NewInterpreter()
+	interp.SetOutput(&out)
+
+	if _, err := interp.Run(`print("hello", {"a": 1})`); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	expected := "\nhello\n{\"a\": 1}\n"
+	if out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestCheckedArithmeticIsPerInterpreter(t *testing.T) {
+	checked := NewInterpreter()
+	checked.SetCheckedArithmetic(true)
+	unchecked := NewInterpreter()
+
+	input := "9223372036854775807 + 1"
+
+	_, err := checked.Run(input)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Message != "integer overflow: 9223372036854775807 + 1" {
+		t.Errorf("runtimeErr.Err.Message wrong, got=%q", runtimeErr.Err.Message)
+	}
+
+	result, err := unchecked.Run(input)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	if result != int64(-9223372036854775808) {
+		t.Errorf("result wrong. expected=-9223372036854775808, got=%#v", result)
+	}
+}
+
+func TestInterpretersKeepTheirOwnImports(t *testing.T) {
+	input := `let c = import "testdata/counter.amoeba"; c["count"][0] += 1`
+
+	// each interpreter runs the file once, however many others run it too
+	var wg sync.WaitGroup
+	results := make([]interface{}, 4)
+	for idx := range results {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			interp := NewInterpreter()
+			for n := 0; n < 10; n++ {
+				result, err := interp.Run(input)
+				if err != nil {
+					t.Errorf("Run returned error: %s", err)
+					return
+				}
+				results[idx] = result
+			}
+		}(idx)
+	}
+	wg.Wait()
+
+	for idx, result := range results {
+		if result != int64(10) {
+			t.Errorf("interpreter %d counted wrong. expected=10, got=%#v", idx, result)
+		}
+	}
+}
+
+func TestSetGlobals(t *testing.T) {
+	interp := NewInterpreter()
+
+	globals := map[string]interface{}{
+		"limit": 10,
+		"ratio": 0.5,
+		"name":  "amoeba",
+		"flags": []interface{}{true, false},
+		"user":  map[string]interface{}{"age": 30},
+		"none":  nil,
+	}
+
+	for name, value := range globals {
+		if err := interp.Set(name, value); err != nil {
+			t.Fatalf("Set(%q) returned error: %s", name, err)
+		}
+	}
+
+	result, err := interp.Run(`
+		if (flags[0] == true) {
+			limit * ratio + user["age"] + len(name)
+		}
+	`)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	if result != 41.0 {
+		t.Errorf("result wrong. expected=41.0, got=%#v", result)
+	}
+
+	if err := interp.Set("bad", struct{}{}); err == nil {
+		t.Errorf("expected error setting an unsupported type")
+	}
+}
+
+func TestFromGoUnsigned(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{uint(7), int64(7)},
+		{uint64(math.MaxInt64), int64(math.MaxInt64)},
+		{uintptr(42), int64(42)},
+		{uint64(math.MaxInt64) + 1, "cannot convert 9223372036854775808 to an amoeba integer, the most it can hold is 9223372036854775807"},
+		{uint64(math.MaxUint64), "cannot convert 18446744073709551615 to an amoeba integer, the most it can hold is 9223372036854775807"},
+	}
+
+	for _, test := range tests {
+		obj, err := FromGo(test.value)
+
+		switch expected := test.expected.(type) {
+		case int64:
+			if err != nil {
+				t.Errorf("FromGo(%T(%d)) returned error: %s", test.value, test.value, err)
+				continue
+			}
+			integer, ok := obj.(*object.Integer)
+			if !ok || integer.Value != expected {
+				t.Errorf("FromGo(%T(%d)) wrong. expected=%d, got=%#v", test.value, test.value, expected, obj)
+			}
+		case string:
+			if err == nil || err.Error() != expected {
+				t.Errorf("FromGo(%T(%d)) error wrong. expected=%q, got=%v", test.value, test.value, expected, err)
+			}
+		}
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	interp := NewInterpreter()
+
+	interp.RegisterFunc("double", func(args ...interface{}) (interface{}, error) {
+		n, ok := args[0].(int64)
+		if !ok {
+			return nil, errors.New("expected an integer")
+		}
+		return n * 2, nil
+	})
+
+	result, err := interp.Run("double(21)")
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	if result != int64(42) {
+		t.Errorf("result wrong. expected=42, got=%#v", result)
+	}
+
+	_, err = interp.Run(`double("x")`)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Message != "double: expected an integer" {
+		t.Errorf("runtimeErr.Err.Message wrong, got=%q", runtimeErr.Err.Message)
+	}
+}
+
+func TestRegisterBuiltinIsPerInterpreter(t *testing.T) {
+	first := NewInterpreter()
+	second := NewInterpreter()
+
+	first.RegisterBuiltin("len", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: -1}
+	})
+
+	result, err := first.Run(`len("abc")`)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	if result != int64(-1) {
+		t.Errorf("overridden len wrong. expected=-1, got=%#v", result)
+	}
+
+	result, err = second.Run(`len("abc")`)
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	if result != int64(3) {
+		t.Errorf("builtin len wrong. expected=3, got=%#v", result)
+	}
+}
+
+func TestEvalReturnsObjects(t *testing.T) {
+	interp := NewInterpreter()
+
+	fn, err := interp.Eval("fn(x) { x * 3 }")
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+
+	if _, ok := fn.(*object.Function); !ok {
+		t.Fatalf("expected *object.Function, got=%T", fn)
+	}
+
+	if err := interp.Set("triple", fn); err != nil {
+		t.Fatalf("Set returned error: %s", err)
+	}
+
+	result, err := interp.Run("triple(3)")
+	if err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	if result != int64(9) {
+		t.Errorf("result wrong. expected=9, got=%#v", result)
+	}
+}
+
+func TestRunContextLimits(t *testing.T) {
+	interp := NewInterpreter()
+	interp.SetLimits(evaluator.Limits{MaxSteps: 5000})
+
+	_, err := interp.Run("let loop = fn() { loop() + 1 }; loop()")
+
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Limit != object.StepLimit {
+		t.Errorf("limit wrong. expected=%q, got=%q", object.StepLimit, runtimeErr.Err.Limit)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	interp.SetLimits(evaluator.Limits{})
+	_, err = interp.RunContext(ctx, "while (true) {}")
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Limit != object.ContextLimit {
+		t.Errorf("limit wrong. expected=%q, got=%q", object.ContextLimit, runtimeErr.Err.Limit)
+	}
+}
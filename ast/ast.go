@@ -12,6 +12,7 @@ import (
 // Node is a single element in a program
 type Node interface {
 	TokenLiteral() string
+	Pos() token.Position
 	String() string
 }
 
@@ -41,6 +42,14 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+// Pos returns the source position of the first statement
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -63,6 +72,9 @@ func (ls *LetStatement) statementNode() {}
 // TokenLiteral returns the token literal for the let statement
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
+// Pos returns the source position for the let statement
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -91,6 +103,9 @@ func (i *Identifier) expressionNode() {}
 // TokenLiteral returns the token literal for the identifier expression
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 
+// Pos returns the source position for the identifier expression
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+
 func (i *Identifier) String() string { return i.Value }
 
 // ReturnStatement is a Statement Node that ends a function call and
@@ -105,6 +120,9 @@ func (rs *ReturnStatement) statementNode() {}
 // TokenLiteral returns the token literal for the return statement
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
 
+// Pos returns the source position for the return statement
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -131,6 +149,10 @@ func (es *ExpressionStatement) statementNode() {}
 // the first token in the expression statement
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
 
+// Pos returns the source position for
+// the first token in the expression statement
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos }
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -149,8 +171,27 @@ func (il *IntegerLiteral) expressionNode() {}
 // TokenLiteral returns the token literal for the integer
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 
+// Pos returns the source position for the integer
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+
 func (il *IntegerLiteral) String() string { return il.Token.Literal }
 
+// FloatLiteral is an Expression Node consisting solely of a floating-point number
+type FloatLiteral struct {
+	Token token.Token // should be a FLOAT token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+
+// TokenLiteral returns the token literal for the float
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+
+// Pos returns the source position for the float
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Pos }
+
+func (fl *FloatLiteral) String() string { return fl.Token.Literal }
+
 // StringLiteral is an Expression Node consisting solely of a string
 type StringLiteral struct {
 	Token token.Token // should be a STRING token
@@ -162,8 +203,43 @@ func (sl *StringLiteral) expressionNode() {}
 // TokenLiteral returns the token literal for the string
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 
+// Pos returns the source position for the string
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
+
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
 
+// TemplateLiteral is an Expression Node for a string with expressions
+// interpolated into it, like "total: ${sum(arr)}". Strings holds the
+// text before, between and after the expressions, so there is always
+// one more of them than there are Expressions
+type TemplateLiteral struct {
+	Token       token.Token // should be a TEMPLATE_HEAD token
+	Strings     []string
+	Expressions []Expression
+}
+
+func (tl *TemplateLiteral) expressionNode() {}
+
+// TokenLiteral returns the token literal for the start of the string
+func (tl *TemplateLiteral) TokenLiteral() string { return tl.Token.Literal }
+
+// Pos returns the source position for the start of the string
+func (tl *TemplateLiteral) Pos() token.Position { return tl.Token.Pos }
+
+func (tl *TemplateLiteral) String() string {
+	var out bytes.Buffer
+
+	for i, exp := range tl.Expressions {
+		out.WriteString(tl.Strings[i])
+		out.WriteString("${")
+		out.WriteString(exp.String())
+		out.WriteString("}")
+	}
+	out.WriteString(tl.Strings[len(tl.Strings)-1])
+
+	return out.String()
+}
+
 // PrefixExpression is an Expression Node that applies
 // a prefix to another expression
 type PrefixExpression struct {
@@ -177,6 +253,9 @@ func (pe *PrefixExpression) expressionNode() {}
 // TokenLiteral returns the token literal for the prefix expression
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
 
+// Pos returns the source position for the prefix expression
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -188,6 +267,40 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// UpdateExpression is an Expression Node that adds one to or subtracts
+// one from an identifier or index, either before its value is taken
+// (++x) or after (x++)
+type UpdateExpression struct {
+	Token    token.Token // should be an update token ("++" or "--")
+	Operator string
+	Target   Expression
+	Prefix   bool
+}
+
+func (ue *UpdateExpression) expressionNode() {}
+
+// TokenLiteral returns the token literal for the update expression
+func (ue *UpdateExpression) TokenLiteral() string { return ue.Token.Literal }
+
+// Pos returns the source position for the update expression
+func (ue *UpdateExpression) Pos() token.Position { return ue.Token.Pos }
+
+func (ue *UpdateExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	if ue.Prefix {
+		out.WriteString(ue.Operator)
+	}
+	out.WriteString(ue.Target.String())
+	if !ue.Prefix {
+		out.WriteString(ue.Operator)
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // InfixExpression is an Expression Node that applies
 // an operator to the expressions on either side of it
 type InfixExpression struct {
@@ -202,6 +315,9 @@ func (ie *InfixExpression) expressionNode() {}
 // TokenLiteral returns the token literal for the infix expression
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
 
+// Pos returns the source position for the infix expression
+func (ie *InfixExpression) Pos() token.Position { return ie.Token.Pos }
+
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -214,6 +330,35 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression is an Expression Node that updates the value of an
+// existing identifier or index, optionally combining it with the old value
+type AssignExpression struct {
+	Token    token.Token // should be an assignment token ("=", "+=", "-=", "*=", "/=")
+	Target   Expression  // Identifier or IndexExpression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+
+// TokenLiteral returns the token literal for the assignment operator
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+
+// Pos returns the source position for the assignment operator
+func (ae *AssignExpression) Pos() token.Position { return ae.Token.Pos }
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // BooleanLiteral is an Expression Node consisting solely of a boolean
 type BooleanLiteral struct {
 	Token token.Token // should be a TRUE or FALSE token
@@ -225,6 +370,9 @@ func (b *BooleanLiteral) expressionNode() {}
 // TokenLiteral returns the token literal for the integer
 func (b *BooleanLiteral) TokenLiteral() string { return b.Token.Literal }
 
+// Pos returns the source position for the boolean
+func (b *BooleanLiteral) Pos() token.Position { return b.Token.Pos }
+
 func (b *BooleanLiteral) String() string { return b.Token.Literal }
 
 // IfExpression is an Expression Node representing a conditional statement
@@ -240,6 +388,9 @@ func (ie *IfExpression) expressionNode() {}
 // TokenLiteral returns the token literal for the if
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 
+// Pos returns the source position for the if
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -256,10 +407,110 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// WhileStatement is a Statement Node that repeats its body for as long
+// as the condition is truthy
+type WhileStatement struct {
+	Token     token.Token // should be a WHILE token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+
+// TokenLiteral returns the token literal for the while
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+
+// Pos returns the source position for the while
+func (ws *WhileStatement) Pos() token.Position { return ws.Token.Pos }
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForStatement is a Statement Node that runs Init once, then repeats its
+// body followed by Update for as long as the condition is truthy.
+// Init, Condition and Update are all optional
+type ForStatement struct {
+	Token     token.Token // should be a FOR token
+	Init      Statement
+	Condition Expression
+	Update    Statement
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+
+// TokenLiteral returns the token literal for the for
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+
+// Pos returns the source position for the for
+func (fs *ForStatement) Pos() token.Position { return fs.Token.Pos }
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	clauses := []string{"", "", ""}
+	if fs.Init != nil {
+		clauses[0] = strings.TrimSuffix(fs.Init.String(), ";")
+	}
+	if fs.Condition != nil {
+		clauses[1] = fs.Condition.String()
+	}
+	if fs.Update != nil {
+		clauses[2] = strings.TrimSuffix(fs.Update.String(), ";")
+	}
+
+	out.WriteString("for (")
+	out.WriteString(strings.Join(clauses, "; "))
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// BreakStatement is a Statement Node that exits the innermost loop
+type BreakStatement struct {
+	Token token.Token // should be a BREAK token
+}
+
+func (bs *BreakStatement) statementNode() {}
+
+// TokenLiteral returns the token literal for the break
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+
+// Pos returns the source position for the break
+func (bs *BreakStatement) Pos() token.Position { return bs.Token.Pos }
+
+func (bs *BreakStatement) String() string { return bs.TokenLiteral() + ";" }
+
+// ContinueStatement is a Statement Node that skips the rest of the
+// body of the innermost loop and starts its next iteration
+type ContinueStatement struct {
+	Token token.Token // should be a CONTINUE token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+
+// TokenLiteral returns the token literal for the continue
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// Pos returns the source position for the continue
+func (cs *ContinueStatement) Pos() token.Position { return cs.Token.Pos }
+
+func (cs *ContinueStatement) String() string { return cs.TokenLiteral() + ";" }
+
 // BlockStatement is a Statement Node that contains statements
 type BlockStatement struct {
 	Token      token.Token // should be a { token
 	Statements []Statement
+	End        token.Position // of the closing }
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -267,6 +518,9 @@ func (bs *BlockStatement) statementNode() {}
 // TokenLiteral returns the token literal for the beginning of the block: {
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
 
+// Pos returns the source position for the beginning of the block: {
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -282,6 +536,7 @@ type FunctionLiteral struct {
 	Token      token.Token // should be an 'fn' token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string // name of the let binding, empty when anonymous
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -289,6 +544,9 @@ func (fl *FunctionLiteral) expressionNode() {}
 // TokenLiteral returns the token literal for the if
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 
+// Pos returns the source position for the fn keyword
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -312,6 +570,7 @@ type CallExpression struct {
 	Token     token.Token // should be a ( token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	End       token.Position // of the closing )
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -319,6 +578,9 @@ func (ce *CallExpression) expressionNode() {}
 // TokenLiteral returns the token literal for the (
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
 
+// Pos returns the source position for the ( of the call
+func (ce *CallExpression) Pos() token.Position { return ce.Token.Pos }
+
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -339,6 +601,7 @@ func (ce *CallExpression) String() string {
 type ArrayLiteral struct {
 	Token    token.Token // should be a [ token
 	Elements []Expression
+	End      token.Position // of the closing ]
 }
 
 func (al *ArrayLiteral) expressionNode() {}
@@ -346,6 +609,9 @@ func (al *ArrayLiteral) expressionNode() {}
 // TokenLiteral returns the token literal for the array: [
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
 
+// Pos returns the source position for the array: [
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
+
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -373,6 +639,9 @@ func (ie *IndexExpression) expressionNode() {}
 // TokenLiteral returns the token literal for the index expression: [
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
 
+// Pos returns the source position for the index expression: [
+func (ie *IndexExpression) Pos() token.Position { return ie.Token.Pos }
+
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -387,8 +656,15 @@ func (ie *IndexExpression) String() string {
 
 // HashLiteral is an Expression Node representing a hash (or object)
 type HashLiteral struct {
-	Token token.Token // should be a { token
-	Pairs map[Expression]Expression
+	Token token.Token    // should be a { token
+	Pairs []HashPair     // in the order they appear in the source
+	End   token.Position // of the closing }
+}
+
+// HashPair is a single key and value in a HashLiteral
+type HashPair struct {
+	Key   Expression
+	Value Expression
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -396,12 +672,15 @@ func (hl *HashLiteral) expressionNode() {}
 // TokenLiteral returns the token literal for the hash literal: {
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 
+// Pos returns the source position for the hash literal: {
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, val := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+val.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
 	}
 
 	out.WriteString("{")
@@ -410,3 +689,22 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// ImportExpression is an Expression Node that loads another
+// source file and evaluates to the bindings it defines
+type ImportExpression struct {
+	Token token.Token // should be an IMPORT token
+	Path  string
+}
+
+func (ie *ImportExpression) expressionNode() {}
+
+// TokenLiteral returns the token literal for the import
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+
+// Pos returns the source position for the import
+func (ie *ImportExpression) Pos() token.Position { return ie.Token.Pos }
+
+func (ie *ImportExpression) String() string {
+	return ie.TokenLiteral() + " \"" + ie.Path + "\""
+}
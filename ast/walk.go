@@ -0,0 +1,104 @@
+package ast
+
+// Inspect calls visit with node and then, as long as visit returns true,
+// with each of the nodes inside it in the order they appear in the source
+func Inspect(node Node, visit func(Node) bool) {
+	if !visit(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, visit)
+		}
+	case *BlockStatement:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, visit)
+		}
+	case *LetStatement:
+		Inspect(node.Name, visit)
+		inspectExpression(node.Value, visit)
+	case *ExpressionStatement:
+		inspectExpression(node.Expression, visit)
+	case *ReturnStatement:
+		inspectExpression(node.ReturnValue, visit)
+	case *WhileStatement:
+		inspectExpression(node.Condition, visit)
+		Inspect(node.Body, visit)
+	case *ForStatement:
+		if node.Init != nil {
+			Inspect(node.Init, visit)
+		}
+		inspectExpression(node.Condition, visit)
+		if node.Update != nil {
+			Inspect(node.Update, visit)
+		}
+		Inspect(node.Body, visit)
+	case *PrefixExpression:
+		inspectExpression(node.Right, visit)
+	case *InfixExpression:
+		inspectExpression(node.Left, visit)
+		inspectExpression(node.Right, visit)
+	case *AssignExpression:
+		inspectExpression(node.Target, visit)
+		inspectExpression(node.Value, visit)
+	case *UpdateExpression:
+		inspectExpression(node.Target, visit)
+	case *IfExpression:
+		inspectExpression(node.Condition, visit)
+		Inspect(node.Consequence, visit)
+		if node.Alternative != nil {
+			Inspect(node.Alternative, visit)
+		}
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			Inspect(param, visit)
+		}
+		Inspect(node.Body, visit)
+	case *CallExpression:
+		inspectExpression(node.Function, visit)
+		for _, arg := range node.Arguments {
+			inspectExpression(arg, visit)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			inspectExpression(el, visit)
+		}
+	case *HashLiteral:
+		for _, pair := range node.Pairs {
+			inspectExpression(pair.Key, visit)
+			inspectExpression(pair.Value, visit)
+		}
+	case *TemplateLiteral:
+		for _, exp := range node.Expressions {
+			inspectExpression(exp, visit)
+		}
+	case *IndexExpression:
+		inspectExpression(node.Left, visit)
+		inspectExpression(node.Index, visit)
+	}
+}
+
+// inspectExpression inspects exp unless it is missing, which it can be
+// when the parser gave up on it
+func inspectExpression(exp Expression, visit func(Node) bool) {
+	if exp != nil {
+		Inspect(exp, visit)
+	}
+}
+
+// Lets calls declare with every let statement in node, leaving out the
+// ones in the bodies of function literals, which belong to the function.
+// These are the names a program or function body binds in its own scope
+func Lets(node Node, declare func(*LetStatement)) {
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *FunctionLiteral:
+			return false
+		case *LetStatement:
+			declare(n)
+		}
+		return true
+	})
+}
@@ -0,0 +1,49 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+)
+
+func TestInspect(t *testing.T) {
+	input := `let a = [1, b(2)]; for (let i = 0; i < 3; i++) { if (c) { d } else { e = {"f": g} } }`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	var names []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		return true
+	})
+
+	expected := []string{"a", "b", "i", "i", "i", "c", "d", "e", "g"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("identifiers wrong. expected=%q, got=%q", expected, names)
+	}
+}
+
+func TestLets(t *testing.T) {
+	input := `
+	let a = 1;
+	let f = fn(x) { let hidden = x; hidden };
+	while (a < 3) { let b = if (true) { let c = 1; c } }
+	for (let i = 0; i < 3; i++) {}
+	let s = "${fn() { let inner = 1 }()}";
+	`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	var names []string
+	ast.Lets(program, func(let *ast.LetStatement) {
+		names = append(names, let.Name.Value)
+	})
+
+	expected := []string{"a", "f", "b", "c", "i", "s"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("lets wrong. expected=%q, got=%q", expected, names)
+	}
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/ASteinheiser/amoeba-interpreter/resolver"
+)
+
+func checkCommand(s *streams, args []string) int {
+	fs := newFlagSet(s, "check", "file|dir|- ...")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	files, err := findFiles(fs.Args(), FileExtension)
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return ExitError
+	}
+
+	code := ExitOK
+	for _, path := range files {
+		if !checkFile(s, path) {
+			code = ExitError
+		}
+	}
+
+	return code
+}
+
+// checkFile prints the problems in the program at path, reporting
+// whether it is free of errors. Warnings don't make a file fail
+func checkFile(s *streams, path string) bool {
+	source, filename, err := readSource(s, path)
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return false
+	}
+
+	program, ok := parseSource(s, source, filename)
+	if !ok {
+		return false
+	}
+
+	names := resolver.New()
+	names.Declare(ArgsName)
+	return !printDiagnostics(s, names.Resolve(program), true)
+}
@@ -0,0 +1,232 @@
+// Package cli implements the amoeba command, which runs programs, starts
+// the REPL and checks and tests Amoeba source files
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/engine"
+	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+	"github.com/ASteinheiser/amoeba-interpreter/resolver"
+)
+
+// Exit codes returned by Main
+const (
+	// ExitOK is returned when everything succeeded
+	ExitOK = 0
+	// ExitError is returned when a program failed to parse, check or run,
+	// or a test failed
+	ExitError = 1
+	// ExitUsage is returned when the command line itself was wrong
+	ExitUsage = 2
+)
+
+// ArgsName is the global that holds the arguments passed to a script
+// after its file name, as an array of strings
+const ArgsName = "args"
+
+// FileExtension ends the names of Amoeba source files
+const FileExtension = ".amoeba"
+
+// stdinName is the file name given to programs read from stdin
+const stdinName = "<stdin>"
+
+// streams are what a subcommand reads from and writes to
+type streams struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// subcommand is one of the things the amoeba command can do
+type subcommand struct {
+	name string
+	help string
+	run  func(s *streams, args []string) int
+}
+
+// subcommands is filled in by init, since help needs to list them
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{"run", "run a program from a file, or from stdin with -", runCommand},
+		{"repl", "start the interactive REPL, the default without a command", replCommand},
+		{"fmt", "print programs in the canonical style, or rewrite them in place", fmtCommand},
+		{"check", "report undefined names and other problems without running", checkCommand},
+		{"test", "run the test functions in *_test.amoeba files", testCommand},
+		{"help", "show this help", helpCommand},
+	}
+}
+
+// Main runs the amoeba command with the arguments after the program
+// name, returning the exit code
+func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	s := &streams{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	// flags without a command are the REPL's, which also keeps the
+	// -file flag working from before there were commands, and runs a
+	// file given after them
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		return replCommand(s, args)
+	}
+
+	for _, cmd := range subcommands {
+		if cmd.name == args[0] {
+			return cmd.run(s, args[1:])
+		}
+	}
+
+	// a script run through a #!/usr/bin/env amoeba line comes as its path
+	if info, err := os.Stat(args[0]); err == nil && !info.IsDir() {
+		return runCommand(s, args)
+	}
+
+	fmt.Fprintf(stderr, "amoeba: unknown command %q\n\n", args[0])
+	printUsage(stderr)
+	return ExitUsage
+}
+
+func printUsage(out io.Writer) {
+	fmt.Fprint(out, "Usage:\n\n\tamoeba <command> [arguments]\n\tamoeba file [arguments]\n\nThe commands are:\n\n")
+	for _, cmd := range subcommands {
+		fmt.Fprintf(out, "\t%-6s %s\n", cmd.name, cmd.help)
+	}
+	fmt.Fprint(out, "\nUse \"amoeba <command> -h\" for the flags of a command.\n")
+}
+
+func helpCommand(s *streams, args []string) int {
+	printUsage(s.stdout)
+	return ExitOK
+}
+
+// newFlagSet creates the flags of a subcommand, reporting errors to stderr
+func newFlagSet(s *streams, name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(s.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(s.stderr, "Usage: amoeba %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// engineOptions are the flags for how programs are run
+type engineOptions struct {
+	name    string
+	checked bool
+	limits  evaluator.Limits
+}
+
+// engineFlags adds the flags for how programs are run
+func engineFlags(fs *flag.FlagSet) *engineOptions {
+	opts := &engineOptions{}
+	fs.StringVar(&opts.name, "engine", engine.Eval, "how to run programs, either eval (tree-walking) or vm (bytecode)")
+	fs.BoolVar(&opts.checked, "checked", false, "report integer overflow as an error instead of wrapping")
+	fs.Int64Var(&opts.limits.MaxSteps, "max-steps", 0, "stop programs after this many steps, 0 for no limit")
+	fs.IntVar(&opts.limits.MaxDepth, "max-depth", evaluator.DefaultMaxDepth, "stop programs nesting more calls than this")
+	fs.DurationVar(&opts.limits.Timeout, "timeout", 0, "stop programs running longer than this, like 5s, 0 for no limit")
+	return opts
+}
+
+// options are how the flags ask for programs to be run, printing to
+// the stdout of s
+func (opts *engineOptions) options(s *streams) evaluator.Options {
+	return evaluator.Options{Limits: opts.limits, CheckedArithmetic: opts.checked, Out: s.stdout}
+}
+
+// newEngine creates the engine the flags ask for, printing to the stdout of s
+func (opts *engineOptions) newEngine(s *streams) (engine.Engine, error) {
+	return engine.New(opts.name, opts.options(s))
+}
+
+// readSource reads the program at path, or stdin when path is -,
+// returning it with the file name to use in error positions
+func readSource(s *streams, path string) (string, string, error) {
+	if path == "-" {
+		data, err := ioutil.ReadAll(s.stdin)
+		return string(data), stdinName, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	return string(data), path, err
+}
+
+// findFiles returns the files in paths ending with suffix, searching
+// directories recursively and taking files named directly, and - for
+// stdin, as they are
+func findFiles(paths []string, suffix string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		if path == "-" {
+			files = append(files, path)
+			continue
+		}
+
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if file == path && !info.IsDir() || strings.HasSuffix(file, suffix) && !info.IsDir() {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// parseSource parses a program, printing any errors to stderr
+func parseSource(s *streams, source, filename string) (*ast.Program, bool) {
+	p := parser.New(lexer.NewWithFilename(source, filename))
+
+	program := p.ParseProgram()
+	for _, msg := range p.Errors() {
+		fmt.Fprintln(s.stderr, msg)
+	}
+
+	return program, len(p.Errors()) == 0
+}
+
+// printDiagnostics prints the problems found by the resolver to stderr,
+// warnings only when asked for, and reports whether any were errors
+func printDiagnostics(s *streams, diagnostics []resolver.Diagnostic, warnings bool) bool {
+	hasErrors := false
+
+	for _, d := range diagnostics {
+		if d.IsError() {
+			hasErrors = true
+			fmt.Fprintf(s.stderr, "%s: error: %s\n", d.Pos, d.Message())
+		} else if warnings {
+			fmt.Fprintf(s.stderr, "%s: warning: %s\n", d.Pos, d.Message())
+		}
+	}
+
+	return hasErrors
+}
+
+// scriptArgs converts the arguments for a script into the array it sees
+func scriptArgs(args []string) *object.Array {
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testMain(t *testing.T, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Main(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		stdin    string
+		args     []string
+		code     int
+		expected string
+	}{
+		{"", []string{"run", "testdata/args.amoeba", "one", "-two"}, ExitOK, ""},
+		{"", []string{"run", "-engine=vm", "testdata/args.amoeba", "one", "-two"}, ExitOK, ""},
+		{"", []string{"-file=testdata/args.amoeba", "one", "-two"}, ExitOK, ""},
+		{"", []string{"testdata/args.amoeba", "one", "-two"}, ExitOK, ""},
+		{"", []string{"-engine=vm", "testdata/args.amoeba", "one", "-two"}, ExitOK, ""},
+		{"", []string{"-checked", "testdata/args.amoeba", "one"}, ExitError, "ERROR: testdata/args.amoeba:2:7: assertion failed"},
+		{
+			"", []string{"run", "testdata/args.amoeba", "one"},
+			ExitError, "ERROR: testdata/args.amoeba:2:7: assertion failed: [\"one\"]\n",
+		},
+		{"let x = 1; x + 1", []string{"run", "-"}, ExitOK, ""},
+		{"let x = ;", []string{"run", "-"}, ExitError, "<stdin>:1:9: no prefix parsing fn for ; found\n"},
+		{"1 + true", []string{"run", "-"}, ExitError, "ERROR: <stdin>:1:3: type mismatch: INTEGER + BOOLEAN\n"},
+		{
+			"print(x)", []string{"run", "-"},
+			ExitError, "<stdin>:1:7: warning: identifier not found: x\nERROR: <stdin>:1:7: identifier not found: x\n",
+		},
+		{"if (false) { x }; 1", []string{"run", "-"}, ExitOK, "<stdin>:1:14: warning: identifier not found: x\n"},
+		{"while (true) {}", []string{"run", "-max-steps=100", "-"}, ExitError, "ERROR: <stdin>:1:1: step limit exceeded: more than 100 steps\n"},
+		{"while (true) {}", []string{"run", "-engine=vm", "-timeout=10ms", "-"}, ExitError, "ERROR: <stdin>:1:"},
+		{"let f = fn() { f() }; f()", []string{"run", "-max-depth=5", "-"}, ExitError, "ERROR: <stdin>:1:17: call depth limit exceeded: more than 5 nested calls\n"},
+		{"", []string{"run", "missing.amoeba"}, ExitError, "open missing.amoeba: no such file or directory\n"},
+		{"", []string{"run", "-engine=js", "-"}, ExitUsage, "unknown engine \"js\", expected eval or vm\n"},
+		{"", []string{"nope"}, ExitUsage, "amoeba: unknown command \"nope\"\n"},
+	}
+
+	for _, test := range tests {
+		code, _, stderr := testMain(t, test.stdin, test.args...)
+		if code != test.code {
+			t.Errorf("%q exited with %d, expected %d", test.args, code, test.code)
+		}
+		if !strings.HasPrefix(stderr, test.expected) || test.expected == "" && stderr != "" {
+			t.Errorf("%q wrong stderr. expected=%q, got=%q", test.args, test.expected, stderr)
+		}
+	}
+}
+
+func TestRunPrintsToStdout(t *testing.T) {
+	for _, name := range []string{"eval", "vm"} {
+		code, stdout, _ := testMain(t, `print("hi", [1])`, "run", "-engine="+name, "-")
+		if code != ExitOK {
+			t.Errorf("%s exited with %d, expected %d", name, code, ExitOK)
+		}
+		if stdout != "\nhi\n[1]\n" {
+			t.Errorf("%s wrong stdout. got=%q", name, stdout)
+		}
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	code, _, stderr := testMain(t, "", "run")
+	if code != ExitUsage {
+		t.Errorf("exited with %d, expected %d", code, ExitUsage)
+	}
+	if !strings.HasPrefix(stderr, "Usage: amoeba run [flags] file|- [arguments]\n") {
+		t.Errorf("wrong usage. got=%q", stderr)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	code, _, stderr := testMain(t, "", "check", "testdata/undefined.amoeba", "testdata/args.amoeba")
+	expected := "testdata/undefined.amoeba:2:7: warning: declared and not used: unused\n" +
+		"testdata/undefined.amoeba:3:11: error: identifier not found: pi\n"
+
+	if code != ExitError {
+		t.Errorf("exited with %d, expected %d", code, ExitError)
+	}
+	if stderr != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, stderr)
+	}
+
+	code, _, stderr = testMain(t, "", "check", "testdata/args.amoeba")
+	if code != ExitOK || stderr != "" {
+		t.Errorf("expected a clean check, exited with %d and %q", code, stderr)
+	}
+
+	// directories are searched for programs, the same as for fmt and test
+	code, _, stderr = testMain(t, "", "check", "testdata")
+	expected = "testdata/undefined.amoeba:2:7: warning: declared and not used: unused\n" +
+		"testdata/undefined.amoeba:3:11: error: identifier not found: pi\n"
+	if code != ExitError || stderr != expected {
+		t.Errorf("expected %q, exited with %d and %q", expected, code, stderr)
+	}
+}
+
+func TestTest(t *testing.T) {
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"test", "testdata/pass"}, ExitOK, "ok  \ttestdata/pass/math_test.amoeba\t2 tests\n"},
+		{[]string{"test", "-engine=vm", "testdata/pass"}, ExitOK, "ok  \ttestdata/pass/math_test.amoeba\t2 tests\n"},
+		{
+			[]string{"test", "testdata/fail/broken_test.amoeba"}, ExitError,
+			"--- FAIL: testFails\n" +
+				"\tERROR: testdata/fail/broken_test.amoeba:4:9: assertion failed: bad math\n" +
+				"FAIL\ttestdata/fail/broken_test.amoeba\t1 of 2 tests failed\n",
+		},
+	}
+
+	for _, test := range tests {
+		code, stdout, _ := testMain(t, "", test.args...)
+		if code != test.code {
+			t.Errorf("%q exited with %d, expected %d", test.args, code, test.code)
+		}
+		if stdout != test.expected {
+			t.Errorf("%q wrong output. expected=%q, got=%q", test.args, test.expected, stdout)
+		}
+	}
+}
+
+func TestFmt(t *testing.T) {
+	tests := []struct {
+		stdin    string
+		args     []string
+		code     int
+		expected string
+	}{
+		{"let x=1", []string{"fmt", "-"}, ExitOK, "let x = 1;\n"},
+		{"", []string{"fmt", "-l", "testdata/unformatted.amoeba", "testdata/args.amoeba"}, ExitOK, "testdata/unformatted.amoeba\n"},
+		{
+			"", []string{"fmt", "-d", "testdata/unformatted.amoeba"}, ExitOK,
+			"--- testdata/unformatted.amoeba.orig\n+++ testdata/unformatted.amoeba\n" +
+				"@@ -1,4 +1,5 @@\n-let square=fn(x){x*x}\n-\n+let square = fn(x) {\n+  x * x\n+};\n \n-print(square(3))\n+print(square(3));\n",
+		},
+		{"let x = ;", []string{"fmt", "-"}, ExitError, ""},
+		{"", []string{"fmt", "-w", "-"}, ExitUsage, ""},
+	}
+
+	for _, test := range tests {
+		code, stdout, _ := testMain(t, test.stdin, test.args...)
+		if code != test.code {
+			t.Errorf("%q exited with %d, expected %d", test.args, code, test.code)
+		}
+		if stdout != test.expected {
+			t.Errorf("%q wrong output. expected=%q, got=%q", test.args, test.expected, stdout)
+		}
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amoeba-fmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "main.amoeba")
+	if err := ioutil.WriteFile(path, []byte("if(x){1}else{2}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, stdout, stderr := testMain(t, "", "fmt", "-w", dir); code != ExitOK || stdout != "" {
+		t.Fatalf("exited with %d, printing %q and %q", code, stdout, stderr)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "if (x) {\n  1\n} else {\n  2\n}\n"
+	if string(data) != expected {
+		t.Errorf("file not rewritten. expected=%q, got=%q", expected, data)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n18\n19\n20\n"
+	b := strings.Replace(strings.Replace(a, "2\n", "two\n", 1), "18\n", "", 1) + "21"
+
+	expected := "--- a\n+++ b\n" +
+		"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+		"@@ -15,6 +15,6 @@\n 15\n 16\n 17\n-18\n 19\n 20\n+21\n\\ No newline at end of file\n"
+
+	if output := diff("a", "b", a, b); output != expected {
+		t.Errorf("wrong diff. expected=\n%s\ngot=\n%s", expected, output)
+	}
+	if output := diff("a", "b", a, a); output != "" {
+		t.Errorf("expected no diff for the same text, got=%q", output)
+	}
+}
@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is how many unchanged lines are shown around each change
+const diffContext = 3
+
+// edit is one line of a diff: kept (' '), removed ('-') or added ('+')
+type edit struct {
+	op   byte
+	line string
+}
+
+// diff returns a unified diff turning a into b, with the names of
+// each in the header, or "" when they are the same
+func diff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+
+	for start := 0; start < len(edits); {
+		// find the next change, then take in the changes after it
+		// that are close enough to share context with the one before
+		first := start
+		for first < len(edits) && edits[first].op == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+
+		last := first
+		for i := first; i < len(edits) && i <= last+2*diffContext+1; i++ {
+			if edits[i].op != ' ' {
+				last = i
+			}
+		}
+
+		from, to := first-diffContext, last+diffContext+1
+		if from < start {
+			from = start
+		}
+		if to > len(edits) {
+			to = len(edits)
+		}
+		writeHunk(&out, edits, from, to)
+		start = to
+	}
+
+	return out.String()
+}
+
+// writeHunk writes the edits from up to to, with the header
+// saying which lines of each file they cover
+func writeHunk(out *bytes.Buffer, edits []edit, from, to int) {
+	aLine, bLine := 1, 1
+	for _, e := range edits[:from] {
+		if e.op != '+' {
+			aLine++
+		}
+		if e.op != '-' {
+			bLine++
+		}
+	}
+
+	aCount, bCount := 0, 0
+	for _, e := range edits[from:to] {
+		if e.op != '+' {
+			aCount++
+		}
+		if e.op != '-' {
+			bCount++
+		}
+	}
+
+	// an empty range is given as the line before it
+	if aCount == 0 {
+		aLine--
+	}
+	if bCount == 0 {
+		bLine--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+	for _, e := range edits[from:to] {
+		out.WriteByte(e.op)
+		out.WriteString(e.line)
+		if !strings.HasSuffix(e.line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// diffLines finds the edits from a to b that keep the most lines,
+// from the longest common subsequence of the two
+func diffLines(a, b []string) []edit {
+	// common[i][j] is the length of the longest common
+	// subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || i < len(a) && common[i+1][j] >= common[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+
+	return edits
+}
+
+// splitLines splits s into lines that keep their newlines
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
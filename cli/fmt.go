@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ASteinheiser/amoeba-interpreter/format"
+)
+
+func fmtCommand(s *streams, args []string) int {
+	fs := newFlagSet(s, "fmt", "[flags] file|dir|- ...")
+	write := fs.Bool("w", false, "write the result back to the files instead of printing it")
+	list := fs.Bool("l", false, "list the files whose formatting differs")
+	showDiff := fs.Bool("d", false, "show the changes formatting would make as a diff")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	files, err := findFiles(fs.Args(), FileExtension)
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return ExitError
+	}
+
+	code := ExitOK
+	for _, path := range files {
+		if path == "-" && *write {
+			fmt.Fprintln(s.stderr, "cannot use -w with stdin")
+			return ExitUsage
+		}
+
+		source, filename, err := readSource(s, path)
+		if err != nil {
+			fmt.Fprintln(s.stderr, err)
+			code = ExitError
+			continue
+		}
+
+		formatted, err := format.Source(source, filename)
+		if err != nil {
+			fmt.Fprintln(s.stderr, err)
+			code = ExitError
+			continue
+		}
+
+		// without any flags the formatted program is the output
+		if !*write && !*list && !*showDiff {
+			fmt.Fprint(s.stdout, formatted)
+			continue
+		}
+		if formatted == source {
+			continue
+		}
+
+		if *list {
+			fmt.Fprintln(s.stdout, filename)
+		}
+		if *showDiff {
+			fmt.Fprint(s.stdout, diff(filename+".orig", filename, source, formatted))
+		}
+		if *write {
+			if err := writeFile(path, formatted); err != nil {
+				fmt.Fprintln(s.stderr, err)
+				code = ExitError
+			}
+		}
+	}
+
+	return code
+}
+
+// writeFile replaces the contents of a file, keeping its permissions
+func writeFile(path, contents string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(contents), info.Mode().Perm())
+}
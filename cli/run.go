@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/repl"
+	"github.com/ASteinheiser/amoeba-interpreter/resolver"
+)
+
+func runCommand(s *streams, args []string) int {
+	fs := newFlagSet(s, "run", "[flags] file|- [arguments]")
+	opts := engineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	return runFile(s, fs.Arg(0), fs.Args()[1:], opts)
+}
+
+// runFile runs the program at path, with args as its script arguments
+func runFile(s *streams, path string, args []string, opts *engineOptions) int {
+	env, err := opts.newEngine(s)
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return ExitUsage
+	}
+
+	source, filename, err := readSource(s, path)
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return ExitError
+	}
+
+	program, ok := parseSource(s, source, filename)
+	if !ok {
+		return ExitError
+	}
+
+	// undefined names only fail once the code using them runs, which a
+	// branch that is never taken doesn't, so they are warnings here
+	names := resolver.New()
+	names.Declare(ArgsName)
+	for _, d := range names.Resolve(program) {
+		if d.IsError() {
+			fmt.Fprintf(s.stderr, "%s: warning: %s\n", d.Pos, d.Message())
+		}
+	}
+
+	env.Set(ArgsName, scriptArgs(args))
+
+	if err, ok := env.Run(program).(*object.Error); ok {
+		fmt.Fprintln(s.stderr, err.Inspect())
+		return ExitError
+	}
+
+	return ExitOK
+}
+
+func replCommand(s *streams, args []string) int {
+	fs := newFlagSet(s, "repl", "[flags]")
+	opts := engineFlags(fs)
+	file := fs.String("file", "", "run a file instead of starting the REPL, the same as amoeba run")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	if *file != "" {
+		return runFile(s, *file, fs.Args(), opts)
+	}
+
+	// a file after the flags is run, for amoeba -engine=vm file
+	if fs.NArg() > 0 {
+		return runFile(s, fs.Arg(0), fs.Args()[1:], opts)
+	}
+
+	// the repl creates its own engine, and again on :reset
+	if _, err := opts.newEngine(s); err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return ExitUsage
+	}
+
+	if err := repl.Start(s.stdin, s.stdout, opts.name, opts.options(s)); err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return ExitError
+	}
+
+	return ExitOK
+}
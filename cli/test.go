@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/engine"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+)
+
+// TestFileSuffix ends the names of the files amoeba test runs
+const TestFileSuffix = "_test" + FileExtension
+
+// TestFuncPrefix starts the names of the functions amoeba test calls
+const TestFuncPrefix = "test"
+
+func testCommand(s *streams, args []string) int {
+	fs := newFlagSet(s, "test", "[flags] [path ...]")
+	opts := engineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findFiles(paths, TestFileSuffix)
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return ExitError
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(s.stderr, "no %s files found\n", TestFileSuffix)
+		return ExitError
+	}
+
+	code := ExitOK
+	for _, file := range files {
+		passed, err := testFile(s, file, opts)
+		if err != nil {
+			fmt.Fprintln(s.stderr, err)
+			return ExitUsage
+		}
+		if !passed {
+			code = ExitError
+		}
+	}
+
+	return code
+}
+
+// testFile runs a test file and then each of its test functions in the
+// order they are declared, reporting whether they all passed. The error
+// is only for an engine that can't be created
+func testFile(s *streams, file string, opts *engineOptions) (bool, error) {
+	env, err := opts.newEngine(s)
+	if err != nil {
+		return false, err
+	}
+
+	source, filename, err := readSource(s, file)
+	if err != nil {
+		fmt.Fprintf(s.stdout, "FAIL\t%s\n\t%s\n", file, err)
+		return false, nil
+	}
+
+	program, ok := parseSource(s, source, filename)
+	if !ok {
+		fmt.Fprintf(s.stdout, "FAIL\t%s\n", file)
+		return false, nil
+	}
+
+	if err, ok := env.Run(program).(*object.Error); ok {
+		fmt.Fprintf(s.stdout, "FAIL\t%s\n\t%s\n", file, err.Inspect())
+		return false, nil
+	}
+
+	names := testFunctions(program, env)
+	failed := 0
+	for _, name := range names {
+		err, ok := env.Run(callProgram(name)).(*object.Error)
+		if !ok {
+			continue
+		}
+
+		// the outermost call is the one made here, which isn't in the file
+		if len(err.Trace) > 0 {
+			trimmed := *err
+			trimmed.Trace = err.Trace[:len(err.Trace)-1]
+			err = &trimmed
+		}
+
+		failed++
+		fmt.Fprintf(s.stdout, "--- FAIL: %s\n\t%s\n", name, strings.Replace(err.Inspect(), "\n", "\n\t", -1))
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(s.stdout, "FAIL\t%s\t%d of %d tests failed\n", file, failed, len(names))
+		return false, nil
+	}
+
+	fmt.Fprintf(s.stdout, "ok  \t%s\t%d tests\n", file, len(names))
+	return true, nil
+}
+
+// testFunctions returns the names of the top-level functions in program
+// that start with TestFuncPrefix and take no arguments
+func testFunctions(program *ast.Program, env engine.Engine) []string {
+	var names []string
+	seen := map[string]bool{}
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, TestFuncPrefix) || seen[let.Name.Value] {
+			continue
+		}
+
+		val, ok := env.Get(let.Name.Value)
+		if !ok {
+			continue
+		}
+
+		switch fn := val.(type) {
+		case *object.Function:
+			ok = len(fn.Parameters) == 0
+		case *object.Closure:
+			ok = fn.Fn.NumParameters == 0
+		default:
+			ok = false
+		}
+		if ok {
+			seen[let.Name.Value] = true
+			names = append(names, let.Name.Value)
+		}
+	}
+
+	return names
+}
+
+// callProgram is the program calling the function called name
+func callProgram(name string) *ast.Program {
+	return parser.New(lexer.New(name + "()")).ParseProgram()
+}
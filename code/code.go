@@ -0,0 +1,279 @@
+// Package code defines the bytecode instructions produced by the
+// compiler and executed by the vm
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a sequence of encoded instructions
+type Instructions []byte
+
+// String disassembles the instructions, one per line
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+// Opcode is the first byte of an instruction
+type Opcode byte
+
+const (
+	// OpConstant pushes a constant from the constant pool
+	OpConstant Opcode = iota
+	// OpTrue pushes true
+	OpTrue
+	// OpFalse pushes false
+	OpFalse
+	// OpNull pushes null
+	OpNull
+	// OpNothing pushes the empty result of a statement that has no value, like let
+	OpNothing
+	// OpPop discards the top of the stack
+	OpPop
+	// OpDup duplicates the top of the stack
+	OpDup
+	// OpDup2 duplicates the top two values of the stack
+	OpDup2
+	// OpBury moves the top of the stack down under the given number of values
+	OpBury
+
+	// OpAdd adds the top two values of the stack
+	OpAdd
+	// OpSub subtracts the top two values of the stack
+	OpSub
+	// OpMul multiplies the top two values of the stack
+	OpMul
+	// OpDiv divides the top two values of the stack
+	OpDiv
+	// OpMod takes the remainder of dividing the top two values of the stack
+	OpMod
+	// OpEqual compares the top two values of the stack with ==
+	OpEqual
+	// OpNotEqual compares the top two values of the stack with !=
+	OpNotEqual
+	// OpLessThan compares the top two values of the stack with <
+	OpLessThan
+	// OpGreaterThan compares the top two values of the stack with >
+	OpGreaterThan
+	// OpLessEqual compares the top two values of the stack with <=
+	OpLessEqual
+	// OpGreaterEqual compares the top two values of the stack with >=
+	OpGreaterEqual
+	// OpMinus negates the top of the stack
+	OpMinus
+	// OpBang applies ! to the top of the stack
+	OpBang
+
+	// OpJump jumps to an offset
+	OpJump
+	// OpJumpNotTruthy pops the top of the stack and jumps to an offset if it is not truthy
+	OpJumpNotTruthy
+	// OpLoopEnter remembers the stack height at the start of a loop
+	OpLoopEnter
+	// OpLoopExit forgets the stack height of the innermost loop
+	OpLoopExit
+	// OpLoopJump resets the stack to the height of the innermost loop and jumps to an offset
+	OpLoopJump
+
+	// OpGetName pushes the value of a name, operand is an index into the refs of the function
+	OpGetName
+	// OpSetName assigns the top of the stack to an existing name, leaving the value on the stack
+	OpSetName
+	// OpDefine pops the top of the stack into a slot of the current scope
+	OpDefine
+
+	// OpArray builds an array from the given number of values on the stack
+	OpArray
+	// OpHash builds a hash from the given number of key and value pairs on the stack
+	OpHash
+	// OpInterpolate joins the given number of values on the stack into a string
+	OpInterpolate
+	// OpIndex indexes into an array or hash
+	OpIndex
+	// OpSetIndex assigns to an index of an array or hash, leaving the value on the stack
+	OpSetIndex
+
+	// OpCall calls a function with the given number of arguments
+	OpCall
+	// OpTailCall calls a function that is being returned, reusing the frame of the current one
+	OpTailCall
+	// OpReturnValue returns the top of the stack from the current function
+	OpReturnValue
+	// OpClosure makes a closure over the current scope from a compiled function constant
+	OpClosure
+
+	// OpImport imports the file at a resolved path constant, the second
+	// operand is a constant with the path as it was written, for errors
+	OpImport
+)
+
+// Definition describes an opcode, its name and the widths of its operands
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:      {"OpConstant", []int{2}},
+	OpTrue:          {"OpTrue", []int{}},
+	OpFalse:         {"OpFalse", []int{}},
+	OpNull:          {"OpNull", []int{}},
+	OpNothing:       {"OpNothing", []int{}},
+	OpPop:           {"OpPop", []int{}},
+	OpDup:           {"OpDup", []int{}},
+	OpDup2:          {"OpDup2", []int{}},
+	OpBury:          {"OpBury", []int{1}},
+	OpAdd:           {"OpAdd", []int{}},
+	OpSub:           {"OpSub", []int{}},
+	OpMul:           {"OpMul", []int{}},
+	OpDiv:           {"OpDiv", []int{}},
+	OpMod:           {"OpMod", []int{}},
+	OpEqual:         {"OpEqual", []int{}},
+	OpNotEqual:      {"OpNotEqual", []int{}},
+	OpLessThan:      {"OpLessThan", []int{}},
+	OpGreaterThan:   {"OpGreaterThan", []int{}},
+	OpLessEqual:     {"OpLessEqual", []int{}},
+	OpGreaterEqual:  {"OpGreaterEqual", []int{}},
+	OpMinus:         {"OpMinus", []int{}},
+	OpBang:          {"OpBang", []int{}},
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpLoopEnter:     {"OpLoopEnter", []int{}},
+	OpLoopExit:      {"OpLoopExit", []int{}},
+	OpLoopJump:      {"OpLoopJump", []int{2}},
+	OpGetName:       {"OpGetName", []int{2}},
+	OpSetName:       {"OpSetName", []int{2}},
+	OpDefine:        {"OpDefine", []int{2}},
+	OpArray:         {"OpArray", []int{2}},
+	OpHash:          {"OpHash", []int{2}},
+	OpInterpolate:   {"OpInterpolate", []int{2}},
+	OpIndex:         {"OpIndex", []int{}},
+	OpSetIndex:      {"OpSetIndex", []int{}},
+	OpCall:          {"OpCall", []int{1}},
+	OpTailCall:      {"OpTailCall", []int{1}},
+	OpReturnValue:   {"OpReturnValue", []int{}},
+	OpClosure:       {"OpClosure", []int{2}},
+	OpImport:        {"OpImport", []int{2, 2}},
+}
+
+// Lookup returns the definition of an opcode
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction from an opcode and its operands
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction, returning
+// them along with the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 decodes a two byte operand
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one byte operand
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
+
+// Slot is the location of a variable, as the number of scopes to walk
+// out from the current one and the index of the variable in that scope
+type Slot struct {
+	Depth int
+	Index int
+}
+
+// Ref is a name referenced by compiled code. Slots lists, innermost first,
+// every scope that declares the name, the first one that has been set
+// holds the value, just like walking out through environments
+type Ref struct {
+	Name  string
+	Slots []Slot
+}
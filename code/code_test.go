@@ -0,0 +1,90 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpCall, []int{255}, []byte{byte(OpCall), 255}},
+		{OpImport, []int{1, 2}, []byte{byte(OpImport), 0, 1, 0, 2}},
+	}
+
+	for _, test := range tests {
+		instruction := Make(test.op, test.operands...)
+
+		if len(instruction) != len(test.expected) {
+			t.Errorf("instruction has wrong length. expected=%d, got=%d",
+				len(test.expected), len(instruction))
+			continue
+		}
+
+		for i, b := range test.expected {
+			if instruction[i] != b {
+				t.Errorf("wrong byte at pos %d. expected=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetName, 1),
+		Make(OpConstant, 65535),
+		Make(OpCall, 2),
+		Make(OpImport, 3, 4),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetName 1
+0004 OpConstant 65535
+0007 OpCall 2
+0009 OpImport 3 4
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nexpected=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpCall, []int{255}, 1},
+		{OpImport, []int{7, 65535}, 4},
+	}
+
+	for _, test := range tests {
+		instruction := Make(test.op, test.operands...)
+
+		def, err := Lookup(byte(test.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != test.bytesRead {
+			t.Fatalf("n wrong. expected=%d, got=%d", test.bytesRead, n)
+		}
+
+		for i, want := range test.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. expected=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package color
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 )
@@ -10,11 +11,11 @@ func isDumbTerm() bool {
 	return os.Getenv("TERM") == "dumb"
 }
 
-func resetColor() {
+func resetColor(w io.Writer) {
 	if isDumbTerm() {
 		return
 	}
-	fmt.Fprint(Writer, "\x1b[0m")
+	fmt.Fprint(w, "\x1b[0m")
 }
 
 func ansiText(fg Color, fgBright bool, bg Color, bgBright bool) string {
@@ -38,12 +39,12 @@ func ansiText(fg Color, fgBright bool, bg Color, bgBright bool) string {
 	return string(s)
 }
 
-func changeColor(fg Color, fgBright bool, bg Color, bgBright bool) {
+func changeColor(w io.Writer, fg Color, fgBright bool, bg Color, bgBright bool) {
 	if isDumbTerm() {
 		return
 	}
 	if fg == None && bg == None {
 		return
 	}
-	fmt.Fprint(Writer, ansiText(fg, fgBright, bg, bgBright))
+	fmt.Fprint(w, ansiText(fg, fgBright, bg, bgBright))
 }
@@ -25,7 +25,12 @@ var Writer io.Writer = os.Stdout
 
 // ResetColor resets the foreground and background to original colors
 func ResetColor() {
-	resetColor()
+	resetColor(Writer)
+}
+
+// ResetColorTo resets the colors like ResetColor, writing to w instead of Writer.
+func ResetColorTo(w io.Writer) {
+	resetColor(w)
 }
 
 // ChangeColor sets the foreground and background colors. If the value of the color is None,
@@ -33,7 +38,7 @@ func ResetColor() {
 // If fgBright or bgBright is set true, corresponding color use bright color. bgBright may be
 // ignored in some OS environment.
 func ChangeColor(fg Color, fgBright bool, bg Color, bgBright bool) {
-	changeColor(fg, fgBright, bg, bgBright)
+	changeColor(Writer, fg, fgBright, bg, bgBright)
 }
 
 // Foreground changes the foreground color.
@@ -41,6 +46,11 @@ func Foreground(cl Color, bright bool) {
 	ChangeColor(cl, bright, None, false)
 }
 
+// ForegroundTo changes the foreground color, writing to w instead of Writer.
+func ForegroundTo(w io.Writer, cl Color, bright bool) {
+	changeColor(w, cl, bright, None, false)
+}
+
 // Background changes the background color.
 func Background(cl Color, bright bool) {
 	ChangeColor(None, false, cl, bright)
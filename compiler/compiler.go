@@ -0,0 +1,725 @@
+// Package compiler turns a parsed program into bytecode for the vm
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/code"
+	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/token"
+)
+
+// Every statement leaves exactly one value on the stack, which is how blocks
+// end up evaluating to their last statement, the same as in the evaluator.
+// Statements with no value, like let, leave a nil behind with OpNothing.
+// Calls and ifs are expressions, so a function body or a branch of an if
+// without a value evaluates to null instead, the nil never gets further.
+//
+// Lets are hoisted: every name a function body declares gets a slot before
+// the body is compiled, so closures can refer to names declared after them.
+// Reading a name checks each scope that declares it from the inside out and
+// uses the first one that has been set, which matches walking environments.
+
+var infixOps = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+	"<=": code.OpLessEqual,
+	">=": code.OpGreaterEqual,
+}
+
+var prefixOps = map[string]code.Opcode{
+	"-": code.OpMinus,
+	"!": code.OpBang,
+}
+
+// Bytecode is a compiled program, Main is run with the scope
+// of the top level of the program as its scope
+type Bytecode struct {
+	Main       *object.CompiledFunction
+	NumGlobals int
+}
+
+// compilationScope holds everything emitted for one function body
+type compilationScope struct {
+	instructions code.Instructions
+	constants    []object.Object
+	refs         []code.Ref
+	refIndexes   map[string]int
+	positions    map[int]token.Position
+	callSites    map[int]token.Position
+	loops        []*loop
+}
+
+// loop collects the jumps out of a loop that can only be
+// patched once the whole loop has been compiled
+type loop struct {
+	breaks    []int
+	continues []int
+}
+
+// Compiler compiles a program into bytecode
+type Compiler struct {
+	symbolTable *SymbolTable
+	globals     *SymbolTable
+
+	scopes []*compilationScope
+	pos    token.Position
+
+	// err is the first operand too big for its instruction,
+	// emitting doesn't fail so it's returned once Compile is done
+	err error
+}
+
+// New creates a compiler with empty globals
+func New() *Compiler {
+	return NewWithState(NewSymbolTable())
+}
+
+// NewWithState creates a compiler that adds to an existing table of
+// globals, so that a REPL can keep its bindings between programs
+func NewWithState(globals *SymbolTable) *Compiler {
+	return &Compiler{
+		symbolTable: globals,
+		globals:     globals,
+		scopes:      []*compilationScope{newCompilationScope()},
+	}
+}
+
+func newCompilationScope() *compilationScope {
+	return &compilationScope{
+		refIndexes: make(map[string]int),
+		positions:  make(map[int]token.Position),
+		callSites:  make(map[int]token.Position),
+	}
+}
+
+// Bytecode returns the compiled program
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Main:       c.function(c.scopes[0], "", nil, nil),
+		NumGlobals: c.globals.NumDefinitions(),
+	}
+}
+
+// Compile compiles a node and everything in it
+func (c *Compiler) Compile(node ast.Node) (err error) {
+	prevPos := c.pos
+	c.pos = node.Pos()
+	defer func() {
+		c.pos = prevPos
+		if err == nil {
+			err = c.err
+		}
+	}()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		hoist(c.symbolTable, node)
+		if err := c.compileStatements(node.Statements); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.BlockStatement:
+		return c.compileStatements(node.Statements)
+
+	case *ast.ExpressionStatement:
+		return c.Compile(node.Expression)
+
+	case *ast.LetStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpDefine, c.symbolTable.Define(node.Name.Value))
+		c.emit(code.OpNothing)
+
+	case *ast.ReturnStatement:
+		if call, ok := node.ReturnValue.(*ast.CallExpression); ok {
+			if err := c.compileCall(call, code.OpTailCall); err != nil {
+				return err
+			}
+		} else if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.WhileStatement:
+		return c.compileLoop(node.Condition, node.Body, nil)
+
+	case *ast.ForStatement:
+		if node.Init != nil {
+			if err := c.Compile(node.Init); err != nil {
+				return err
+			}
+			c.emit(code.OpPop)
+		}
+		return c.compileLoop(node.Condition, node.Body, node.Update)
+
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		scope := c.currentScope()
+		if len(scope.loops) == 0 {
+			return fmt.Errorf("%s outside of a loop", node.TokenLiteral())
+		}
+
+		l := scope.loops[len(scope.loops)-1]
+		jumpPos := c.emit(code.OpLoopJump, 9999)
+		if _, ok := node.(*ast.BreakStatement); ok {
+			l.breaks = append(l.breaks, jumpPos)
+		} else {
+			l.continues = append(l.continues, jumpPos)
+		}
+
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.BooleanLiteral:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Identifier:
+		c.emit(code.OpGetName, c.addRef(node.Value))
+
+	case *ast.PrefixExpression:
+		op, ok := prefixOps[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogical(node)
+		}
+		op, ok := infixOps[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.AssignExpression:
+		return c.compileAssign(node)
+
+	case *ast.UpdateExpression:
+		return c.compileUpdate(node)
+
+	case *ast.IfExpression:
+		return c.compileIf(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node)
+
+	case *ast.CallExpression:
+		return c.compileCall(node, code.OpCall)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs))
+
+	case *ast.TemplateLiteral:
+		for i, exp := range node.Expressions {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Strings[i]}))
+			if err := c.Compile(exp); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Strings[len(node.Strings)-1]}))
+		c.emit(code.OpInterpolate, len(node.Strings)+len(node.Expressions))
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.ImportExpression:
+		path := evaluator.ResolveImportPath(node.Path, node.Token.Pos.Filename)
+		c.emit(code.OpImport,
+			c.addConstant(&object.String{Value: path}),
+			c.addConstant(&object.String{Value: node.Path}))
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+// compileStatements compiles a list of statements that evaluates to the
+// value of the last one, or to nothing if there are no statements
+func (c *Compiler) compileStatements(statements []ast.Statement) error {
+	if len(statements) == 0 {
+		c.emit(code.OpNothing)
+		return nil
+	}
+
+	for i, s := range statements {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+		if i < len(statements)-1 {
+			c.emit(code.OpPop)
+		}
+	}
+
+	return nil
+}
+
+// compileBody compiles the body of a function or a branch of an if, which
+// evaluates to null when its last statement has no value
+func (c *Compiler) compileBody(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if !hasValue(block) {
+		c.emit(code.OpPop)
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// hasValue reports whether block evaluates to something, which it
+// doesn't when it is empty or its last statement is a let
+func hasValue(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, isLet := block.Statements[len(block.Statements)-1].(*ast.LetStatement)
+	return !isLet
+}
+
+// compileCall compiles a call with op, either OpCall or OpTailCall
+func (c *Compiler) compileCall(node *ast.CallExpression, op code.Opcode) error {
+	prevPos := c.pos
+	c.pos = node.Pos()
+	defer func() { c.pos = prevPos }()
+
+	if len(node.Arguments) > 255 {
+		return fmt.Errorf("too many arguments in call to %s", node.Function.String())
+	}
+	if err := c.Compile(node.Function); err != nil {
+		return err
+	}
+	for _, arg := range node.Arguments {
+		if err := c.Compile(arg); err != nil {
+			return err
+		}
+	}
+
+	callPos := c.emit(op, len(node.Arguments))
+	c.currentScope().callSites[callPos] = node.Function.Pos()
+
+	return nil
+}
+
+func (c *Compiler) compileIf(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBody(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBody(node.Alternative); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileLogical compiles && and ||, jumping over the right side when
+// the left one already decides the result. Either way the result is
+// true or false, so a right side that is used is turned into one with !!
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if err := c.compileTruthiness(node.Right); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		return nil
+	}
+
+	if err := c.compileTruthiness(node.Right); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	c.emit(code.OpFalse)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileTruthiness compiles exp followed by !!, leaving true or false
+func (c *Compiler) compileTruthiness(exp ast.Expression) error {
+	if err := c.Compile(exp); err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	return nil
+}
+
+// compileLoop compiles the condition, body and update shared by while and
+// for loops, either of condition and update can be missing
+func (c *Compiler) compileLoop(condition ast.Expression, body *ast.BlockStatement, update ast.Statement) error {
+	scope := c.currentScope()
+	l := &loop{}
+	scope.loops = append(scope.loops, l)
+
+	c.emit(code.OpLoopEnter)
+	startPos := len(c.currentInstructions())
+
+	exitJumps := []int{}
+	if condition != nil {
+		if err := c.Compile(condition); err != nil {
+			return err
+		}
+		exitJumps = append(exitJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	if err := c.Compile(body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+
+	continuePos := len(c.currentInstructions())
+	if update != nil {
+		if err := c.Compile(update); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+	c.emit(code.OpJump, startPos)
+
+	exitPos := c.emit(code.OpLoopExit)
+	c.emit(code.OpNull)
+
+	for _, pos := range exitJumps {
+		c.changeOperand(pos, exitPos)
+	}
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, exitPos)
+	}
+	for _, pos := range l.continues {
+		c.changeOperand(pos, continuePos)
+	}
+
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	return nil
+}
+
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	var op code.Opcode
+	if node.Operator != "=" {
+		var ok bool
+		op, ok = infixOps[node.Operator[:len(node.Operator)-1]]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		ref := c.addRef(target.Value)
+		if node.Operator != "=" {
+			c.emit(code.OpGetName, ref)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if node.Operator != "=" {
+			c.emit(op)
+		}
+		c.emit(code.OpSetName, ref)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		if node.Operator != "=" {
+			c.emit(code.OpDup2)
+			c.emit(code.OpIndex)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if node.Operator != "=" {
+			c.emit(op)
+		}
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("cannot assign to %s", node.Target.String())
+	}
+
+	return nil
+}
+
+// compileUpdate compiles ++ and -- like += 1 and -= 1, except that
+// the postfix forms keep a copy of the value from before under
+// everything else, and pop the new value to leave it
+func (c *Compiler) compileUpdate(node *ast.UpdateExpression) error {
+	op := infixOps[node.Operator[:1]]
+	one := c.addConstant(&object.Integer{Value: 1})
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		ref := c.addRef(target.Value)
+		c.emit(code.OpGetName, ref)
+		if !node.Prefix {
+			c.emit(code.OpDup)
+		}
+		c.emit(code.OpConstant, one)
+		c.emit(op)
+		c.emit(code.OpSetName, ref)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpDup2)
+		c.emit(code.OpIndex)
+		if !node.Prefix {
+			c.emit(code.OpDup)
+			c.emit(code.OpBury, 3)
+		}
+		c.emit(code.OpConstant, one)
+		c.emit(op)
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("cannot apply %s to %s", node.Operator, node.Target.String())
+	}
+
+	if !node.Prefix {
+		c.emit(code.OpPop)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	for _, p := range node.Parameters {
+		c.symbolTable.DefineParameter(p.Value)
+	}
+	hoist(c.symbolTable, node.Body)
+
+	if err := c.compileBody(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	scope, numSlots := c.leaveScope()
+
+	fn := c.function(scope, node.Name, node.Parameters, node.Body)
+	fn.NumSlots = numSlots
+	c.emit(code.OpClosure, c.addConstant(fn))
+
+	return nil
+}
+
+func (c *Compiler) function(
+	scope *compilationScope,
+	name string,
+	params []*ast.Identifier,
+	body *ast.BlockStatement,
+) *object.CompiledFunction {
+	return &object.CompiledFunction{
+		Instructions:  scope.instructions,
+		Constants:     scope.constants,
+		Refs:          scope.refs,
+		NumSlots:      c.globals.NumDefinitions(),
+		NumParameters: len(params),
+		Name:          name,
+		Positions:     scope.positions,
+		CallSites:     scope.callSites,
+		Parameters:    params,
+		Body:          body,
+	}
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, newCompilationScope())
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() (*compilationScope, int) {
+	scope := c.currentScope()
+	numSlots := c.symbolTable.NumDefinitions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.symbolTable = c.symbolTable.Outer
+
+	return scope, numSlots
+}
+
+func (c *Compiler) currentScope() *compilationScope {
+	return c.scopes[len(c.scopes)-1]
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.currentScope().instructions
+}
+
+// emit adds an instruction, tagged with the position of the node
+// being compiled, and returns the offset it was added at
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+
+	scope := c.currentScope()
+	pos := len(scope.instructions)
+
+	scope.instructions = append(scope.instructions, code.Make(op, operands...)...)
+	scope.positions[pos] = c.pos
+
+	return pos
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	scope := c.currentScope()
+	op := code.Opcode(scope.instructions[opPos])
+	c.checkOperands(op, operand)
+	copy(scope.instructions[opPos:], code.Make(op, operand))
+}
+
+// checkOperands records an error for an operand that doesn't fit in
+// the bytes its instruction has for it, which Make would truncate
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+
+	for i, operand := range operands {
+		max := 1<<(8*uint(def.OperandWidths[i])) - 1
+		if operand <= max {
+			continue
+		}
+
+		switch op {
+		case code.OpConstant, code.OpClosure, code.OpImport:
+			c.err = fmt.Errorf("too many constants: a function can have at most %d", max+1)
+		case code.OpJump, code.OpJumpNotTruthy, code.OpLoopJump:
+			c.err = fmt.Errorf("function too long: jump target %d is past %d", operand, max)
+		default:
+			c.err = fmt.Errorf("%s operand out of range: %d is more than %d", def.Name, operand, max)
+		}
+		return
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	scope := c.currentScope()
+	scope.constants = append(scope.constants, obj)
+	return len(scope.constants) - 1
+}
+
+// addRef returns the index of the ref for name in the current function,
+// names that no scope declares are given a global slot, so a global
+// defined later on, even by a later REPL line, is still found
+func (c *Compiler) addRef(name string) int {
+	scope := c.currentScope()
+	if index, ok := scope.refIndexes[name]; ok {
+		return index
+	}
+
+	ref := code.Ref{Name: name}
+	depth := 0
+	for table := c.symbolTable; table != nil; table = table.Outer {
+		if index, ok := table.Resolve(name); ok {
+			ref.Slots = append(ref.Slots, code.Slot{Depth: depth, Index: index})
+		} else if table == c.globals {
+			ref.Slots = append(ref.Slots, code.Slot{Depth: depth, Index: table.Define(name)})
+		}
+		depth++
+	}
+
+	scope.refs = append(scope.refs, ref)
+	scope.refIndexes[name] = len(scope.refs) - 1
+
+	return len(scope.refs) - 1
+}
+
+// hoist declares every name a let in node binds, without
+// looking inside the bodies of nested functions
+func hoist(table *SymbolTable, node ast.Node) {
+	ast.Lets(node, func(let *ast.LetStatement) {
+		table.Define(let.Name.Value)
+	})
+}
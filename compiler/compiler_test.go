@@ -0,0 +1,368 @@
+package compiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/code"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+)
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func compile(t *testing.T, input string) *Bytecode {
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(t *testing.T, input string, expected code.Instructions, actual code.Instructions) {
+	if actual.String() != expected.String() {
+		t.Errorf("wrong instructions for %q.\nexpected=\n%s\ngot=\n%s", input, expected, actual)
+	}
+}
+
+func TestCompileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []code.Instructions
+	}{
+		{
+			"1 + 2",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"let x = 1; x",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDefine, 0),
+				code.Make(code.OpNothing),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetName, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"",
+			[]code.Instructions{
+				code.Make(code.OpNothing),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"if (true) { 10 }",
+			[]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"while (true) { break }",
+			[]code.Instructions{
+				code.Make(code.OpLoopEnter),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 12),
+				code.Make(code.OpLoopJump, 12),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 1),
+				code.Make(code.OpLoopExit),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"return f(1)",
+			[]code.Instructions{
+				code.Make(code.OpGetName, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpTailCall, 1),
+				code.Make(code.OpReturnValue),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"let a = [1]; a[0] += 2",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpDefine, 0),
+				code.Make(code.OpNothing),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetName, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"true && false",
+			[]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpFalse),
+				code.Make(code.OpBang),
+				code.Make(code.OpBang),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpFalse),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"false || true",
+			[]code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpJumpNotTruthy, 8),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpBang),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"let x = 1; x++",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDefine, 0),
+				code.Make(code.OpNothing),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetName, 0),
+				code.Make(code.OpDup),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetName, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"let a = [1]; --a[0]",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpDefine, 0),
+				code.Make(code.OpNothing),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetName, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpDup2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSub),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"let a = [1]; a[0]++",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpDefine, 0),
+				code.Make(code.OpNothing),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetName, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpDup2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpDup),
+				code.Make(code.OpBury, 3),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			`"a${1}b${2}"`,
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpInterpolate, 5),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		bytecode := compile(t, test.input)
+		testInstructions(t, test.input, concatInstructions(test.expected), bytecode.Main.Instructions)
+	}
+}
+
+func TestCompileFunctions(t *testing.T) {
+	input := "fn(a) { let b = a; b }"
+	bytecode := compile(t, input)
+
+	testInstructions(t, input, concatInstructions([]code.Instructions{
+		code.Make(code.OpClosure, 0),
+		code.Make(code.OpReturnValue),
+	}), bytecode.Main.Instructions)
+
+	fn, ok := bytecode.Main.Constants[0].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant not of type *object.CompiledFunction, got=%T", bytecode.Main.Constants[0])
+	}
+
+	testInstructions(t, input, concatInstructions([]code.Instructions{
+		code.Make(code.OpGetName, 0),
+		code.Make(code.OpDefine, 1),
+		code.Make(code.OpNothing),
+		code.Make(code.OpPop),
+		code.Make(code.OpGetName, 1),
+		code.Make(code.OpReturnValue),
+	}), fn.Instructions)
+
+	if fn.NumSlots != 2 || fn.NumParameters != 1 {
+		t.Errorf("wrong slots. expected=2 slots and 1 parameter, got=%d and %d",
+			fn.NumSlots, fn.NumParameters)
+	}
+}
+
+func TestRefsWalkOutThroughScopes(t *testing.T) {
+	input := `
+	let x = 1;
+	let f = fn() {
+		let g = fn() { x + y + z };
+		let x = 2;
+		let y = 3;
+		g
+	}
+	`
+	bytecode := compile(t, input)
+
+	f := bytecode.Main.Constants[1].(*object.CompiledFunction)
+	g := f.Constants[0].(*object.CompiledFunction)
+
+	expected := []code.Ref{
+		// declared by f after g, and at the top level
+		{Name: "x", Slots: []code.Slot{{Depth: 1, Index: 1}, {Depth: 2, Index: 0}}},
+		// declared by f after g, so it still gets f's slot, falling
+		// back to a global in case g runs before the let does
+		{Name: "y", Slots: []code.Slot{{Depth: 1, Index: 2}, {Depth: 2, Index: 2}}},
+		// declared nowhere, so it only gets a global slot
+		{Name: "z", Slots: []code.Slot{{Depth: 2, Index: 3}}},
+	}
+
+	if len(g.Refs) < 3 {
+		t.Fatalf("wrong number of refs. expected=3, got=%d (%+v)", len(g.Refs), g.Refs)
+	}
+
+	for _, ref := range expected {
+		found := false
+		for _, actual := range g.Refs {
+			if actual.Name == ref.Name {
+				found = true
+				if !reflect.DeepEqual(actual, ref) {
+					t.Errorf("ref wrong. expected=%+v, got=%+v", ref, actual)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no ref for %s", ref.Name)
+		}
+	}
+
+	// x, f, y and z, plus g from the body of f
+	if bytecode.NumGlobals != 5 {
+		t.Errorf("wrong number of globals. expected=5, got=%d", bytecode.NumGlobals)
+	}
+}
+
+func TestSymbolTableDefine(t *testing.T) {
+	global := NewSymbolTable()
+
+	if global.Define("a") != 0 || global.Define("b") != 1 {
+		t.Fatalf("globals not given slots in order")
+	}
+	if global.Define("a") != 0 {
+		t.Errorf("redefining a name should keep its slot")
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	if local.DefineParameter("x") != 0 || local.DefineParameter("x") != 1 {
+		t.Errorf("repeated parameters should each get a slot")
+	}
+
+	if index, ok := local.Resolve("x"); !ok || index != 1 {
+		t.Errorf("repeated parameter should resolve to the last slot, got=%d", index)
+	}
+
+	if _, ok := local.Resolve("a"); ok {
+		t.Errorf("Resolve should not look at outer scopes")
+	}
+}
+
+func TestBreakOutsideLoop(t *testing.T) {
+	program := &ast.Program{Statements: []ast.Statement{&ast.BreakStatement{}}}
+	program.Statements[0].(*ast.BreakStatement).Token.Literal = "break"
+
+	err := New().Compile(program)
+	if err == nil || err.Error() != "break outside of a loop" {
+		t.Errorf("expected break outside of a loop error, got=%v", err)
+	}
+}
+
+func TestOperandOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			strings.Repeat("1;", 65537),
+			"too many constants: a function can have at most 65536",
+		},
+		{
+			"let x = 1; if (x) {" + strings.Repeat("x;", 17000) + "}",
+			"function too long: jump target 68016 is past 65535",
+		},
+	}
+
+	for _, test := range tests {
+		err := New().Compile(parse(test.input))
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("expected %q, got=%v", test.expected, err)
+		}
+	}
+
+	// the largest operands still fit
+	if err := New().Compile(parse(strings.Repeat("1;", 65536))); err != nil {
+		t.Errorf("compiler error: %s", err)
+	}
+}
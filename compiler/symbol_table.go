@@ -0,0 +1,59 @@
+package compiler
+
+// SymbolTable maps the names declared in one scope, a function body or the
+// top level of a program, to the slots that hold their values at runtime
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store map[string]int
+	names []string
+}
+
+// NewSymbolTable creates a symbol table for the top level of a program
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]int)}
+}
+
+// NewEnclosedSymbolTable creates a symbol table for a function body
+// nested inside outer
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define declares name in this scope, returning its slot. Declaring
+// a name again returns the slot it already has, the same way a second
+// let of a name overwrites the first
+func (s *SymbolTable) Define(name string) int {
+	if index, ok := s.store[name]; ok {
+		return index
+	}
+	return s.define(name)
+}
+
+// DefineParameter declares a parameter, which always gets a new slot so
+// that every argument has somewhere to go, even if names repeat
+func (s *SymbolTable) DefineParameter(name string) int {
+	return s.define(name)
+}
+
+func (s *SymbolTable) define(name string) int {
+	index := len(s.names)
+	s.store[name] = index
+	s.names = append(s.names, name)
+	return index
+}
+
+// Resolve returns the slot of name if it is declared in this scope,
+// without looking at outer scopes
+func (s *SymbolTable) Resolve(name string) (int, bool) {
+	index, ok := s.store[name]
+	return index, ok
+}
+
+// NumDefinitions returns the number of slots in this scope
+func (s *SymbolTable) NumDefinitions() int { return len(s.names) }
+
+// Names returns the names declared in this scope, in slot order
+func (s *SymbolTable) Names() []string { return s.names }
@@ -0,0 +1,113 @@
+// Package engine runs parsed programs with either the tree-walking
+// evaluator or the bytecode compiler and vm, behind one interface
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/compiler"
+	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/vm"
+)
+
+const (
+	// Eval is the name of the engine that walks the ast with the evaluator
+	Eval = "eval"
+	// VM is the name of the engine that compiles to bytecode for the vm
+	VM = "vm"
+)
+
+// Engine runs parsed programs, keeping the globals they define between runs
+type Engine interface {
+	// Run runs a program, returning the value of its last statement
+	// or the *object.Error it failed with
+	Run(program *ast.Program) object.Object
+	// Names returns the names of the globals that have a value, sorted
+	Names() []string
+	// Get returns the value of a global
+	Get(name string) (object.Object, bool)
+	// Set defines a global, for programs run afterwards to use
+	Set(name string, val object.Object)
+}
+
+// New creates the engine called name, with no globals defined and
+// nothing imported, running every program with opts
+func New(name string, opts evaluator.Options) (Engine, error) {
+	// files imported by one run stay imported for the next
+	if opts.Modules == nil {
+		opts.Modules = evaluator.NewModules()
+	}
+
+	switch name {
+	case Eval:
+		return &treeWalker{env: object.NewEnvironment(), opts: opts}, nil
+	case VM:
+		return &bytecodeVM{symbols: compiler.NewSymbolTable(), globals: &object.Scope{}, opts: opts}, nil
+	default:
+		return nil, fmt.Errorf("unknown engine %q, expected %s or %s", name, Eval, VM)
+	}
+}
+
+// treeWalker runs programs by walking the ast with the evaluator
+type treeWalker struct {
+	env  *object.Environment
+	opts evaluator.Options
+}
+
+func (tw *treeWalker) Run(program *ast.Program) object.Object {
+	return evaluator.EvalWithOptions(context.Background(), program, tw.env, tw.opts)
+}
+
+func (tw *treeWalker) Names() []string { return tw.env.Names() }
+
+func (tw *treeWalker) Get(name string) (object.Object, bool) { return tw.env.Get(name) }
+
+func (tw *treeWalker) Set(name string, val object.Object) { tw.env.Set(name, val) }
+
+// bytecodeVM runs programs by compiling them to bytecode for the vm
+type bytecodeVM struct {
+	symbols *compiler.SymbolTable
+	globals *object.Scope
+	opts    evaluator.Options
+}
+
+func (bv *bytecodeVM) Run(program *ast.Program) object.Object {
+	comp := compiler.NewWithState(bv.symbols)
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: "compiler error: " + err.Error()}
+	}
+
+	return vm.NewWithGlobals(comp.Bytecode(), bv.globals).RunWithOptions(context.Background(), bv.opts)
+}
+
+func (bv *bytecodeVM) Names() []string {
+	// names that were only referenced have a slot too, but never a value
+	var names []string
+	for i, name := range bv.symbols.Names() {
+		if i < len(bv.globals.Slots) && bv.globals.Slots[i] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (bv *bytecodeVM) Get(name string) (object.Object, bool) {
+	index, ok := bv.symbols.Resolve(name)
+	if !ok || index >= len(bv.globals.Slots) || bv.globals.Slots[index] == nil {
+		return nil, false
+	}
+	return bv.globals.Slots[index], true
+}
+
+func (bv *bytecodeVM) Set(name string, val object.Object) {
+	index := bv.symbols.Define(name)
+	for len(bv.globals.Slots) <= index {
+		bv.globals.Slots = append(bv.globals.Slots, nil)
+	}
+	bv.globals.Slots[index] = val
+}
@@ -2,22 +2,18 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/ASteinheiser/amoeba-interpreter/color"
 	"github.com/ASteinheiser/amoeba-interpreter/object"
 )
 
+// builtins are the builtin functions that don't write anything, the ones
+// that do are made for each run by newBuiltins, to write where it asks
 var builtins = map[string]*object.Builtin{
-	"print": {
-		Fn: func(args ...object.Object) object.Object {
-			fmt.Println()
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-
-			return NULL
-		},
-	},
 	"len": {
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
@@ -26,7 +22,8 @@ var builtins = map[string]*object.Builtin{
 
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				// characters, not the bytes it takes to encode them
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
 			default:
@@ -108,26 +105,113 @@ var builtins = map[string]*object.Builtin{
 			return &object.Array{Elements: newElements}
 		},
 	},
-	"amoeba": {
+	"int": {
 		Fn: func(args ...object.Object) object.Object {
-			color.Foreground(color.Green, false)
-			fmt.Print("\n")
-			fmt.Print("             ,,,,g,\n")
-			fmt.Print("           #\"`    `@\n")
-			fmt.Print("          @        \\b\n")
-			fmt.Print("          jb    ##m @      ,smWWm\n")
-			fmt.Print("           7m  ]#### '`7^\"\"      @\n")
-			fmt.Print("             %n 7##b      #j@     b\n")
-			fmt.Print("              @            ,,,,,,M`\n")
-			fmt.Print("              @    ,w    ,M|'\n")
-			fmt.Print("            ,#`   7m#`  ]b\n")
-			fmt.Print("            @b         {^\n")
-			fmt.Print("             %m     a#/\n")
-			fmt.Print("               ^\"\"`^\n")
-			fmt.Print("\n")
-			color.ResetColor()
+			if len(args) != 1 {
+				return newError("wrong number of arguments passed to `int`: got %d, want 1", len(args))
+			}
 
-			return NULL
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+			case *object.Float:
+				return &object.Integer{Value: int64(arg.Value)}
+			case *object.String:
+				value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+				if err != nil {
+					return newError("could not parse %q as an integer", arg.Value)
+				}
+				return &object.Integer{Value: value}
+			default:
+				return newError("argument to `int` not supported: %s", args[0].Type())
+			}
 		},
 	},
+	"float": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments passed to `float`: got %d, want 1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return &object.Float{Value: float64(arg.Value)}
+			case *object.Float:
+				return arg
+			case *object.String:
+				value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError("could not parse %q as a float", arg.Value)
+				}
+				return &object.Float{Value: value}
+			default:
+				return newError("argument to `float` not supported: %s", args[0].Type())
+			}
+		},
+	},
+	"assert": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments passed to `assert`: got %d, want 1 or 2", len(args))
+			}
+
+			if isTruthy(args[0]) {
+				return NULL
+			}
+			if len(args) == 2 {
+				return newError("assertion failed: %s", args[1].Inspect())
+			}
+			return newError("assertion failed")
+		},
+	},
+}
+
+// newBuiltins returns every builtin function, with print and amoeba
+// writing to out
+func newBuiltins(out io.Writer) map[string]*object.Builtin {
+	all := make(map[string]*object.Builtin, len(builtins)+2)
+	for name, builtin := range builtins {
+		all[name] = builtin
+	}
+
+	all["print"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			fmt.Fprintln(out)
+			for _, arg := range args {
+				// strings are printed as they are, anything else
+				// the way the REPL shows it
+				if str, ok := arg.(*object.String); ok {
+					fmt.Fprintln(out, str.Value)
+				} else {
+					fmt.Fprintln(out, object.Pretty(arg, object.DefaultWidth))
+				}
+			}
+
+			return NULL
+		},
+	}
+	all["amoeba"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			color.ForegroundTo(out, color.Green, false)
+			fmt.Fprint(out, "\n")
+			fmt.Fprint(out, "             ,,,,g,\n")
+			fmt.Fprint(out, "           #\"`    `@\n")
+			fmt.Fprint(out, "          @        \\b\n")
+			fmt.Fprint(out, "          jb    ##m @      ,smWWm\n")
+			fmt.Fprint(out, "           7m  ]#### '`7^\"\"      @\n")
+			fmt.Fprint(out, "             %n 7##b      #j@     b\n")
+			fmt.Fprint(out, "              @            ,,,,,,M`\n")
+			fmt.Fprint(out, "              @    ,w    ,M|'\n")
+			fmt.Fprint(out, "            ,#`   7m#`  ]b\n")
+			fmt.Fprint(out, "            @b         {^\n")
+			fmt.Fprint(out, "             %m     a#/\n")
+			fmt.Fprint(out, "               ^\"\"`^\n")
+			fmt.Fprint(out, "\n")
+			color.ResetColorTo(out)
+
+			return NULL
+		},
+	}
+
+	return all
 }
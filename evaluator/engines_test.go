@@ -0,0 +1,27 @@
+package evaluator_test
+
+import (
+	"context"
+
+	"github.com/ASteinheiser/amoeba-interpreter/compiler"
+	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+	"github.com/ASteinheiser/amoeba-interpreter/vm"
+)
+
+// the vm has to give the same result as the evaluator for every program
+// the evaluator is tested with
+func init() {
+	evaluator.Engines["vm"] = func(input string, opts evaluator.Options) object.Object {
+		program := parser.New(lexer.New(input)).ParseProgram()
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			return &object.Error{Message: "compiler error: " + err.Error()}
+		}
+
+		return vm.New(comp.Bytecode()).RunWithOptions(context.Background(), opts)
+	}
+}
@@ -1,10 +1,16 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/ASteinheiser/amoeba-interpreter/ast"
 	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/token"
 )
 
 var (
@@ -14,64 +20,204 @@ var (
 	TRUE = &object.Boolean{Value: true}
 	// FALSE is the boolean object for false values
 	FALSE = &object.Boolean{Value: false}
+	// BREAK is the object that unwinds a loop body on break
+	BREAK = &object.Break{}
+	// CONTINUE is the object that unwinds a loop body on continue
+	CONTINUE = &object.Continue{}
 )
 
+// Limits bounds the work a single evaluation may do. A zero MaxSteps or
+// Timeout leaves that part of it unlimited, a zero MaxDepth means
+// DefaultMaxDepth, since nested calls would otherwise crash the process
+// once they run out of stack
+type Limits struct {
+	MaxSteps int64         // number of nodes evaluated, counted across every call
+	MaxDepth int           // number of function calls nested inside each other
+	Timeout  time.Duration // how long the whole evaluation may take
+}
+
+// DefaultMaxDepth is how deeply calls can nest when Limits doesn't say,
+// which stays well within the stack a goroutine is allowed
+const DefaultMaxDepth = 10000
+
+// Options change how a single evaluation runs, the vm takes the
+// same ones so that both ways of running a program behave alike
+type Options struct {
+	Limits
+
+	// CheckedArithmetic makes integer arithmetic that overflows an int64
+	// return an error, instead of silently wrapping around
+	CheckedArithmetic bool
+
+	// Modules are the files imported so far, which runs sharing them only
+	// run once. When nil, each evaluation starts with nothing imported
+	Modules *Modules
+
+	// Out is where print and amoeba write, os.Stdout when nil
+	Out io.Writer
+}
+
+// ContextCheckInterval is how many steps go by between checks of the
+// context, so that checking it stays cheap next to evaluating
+const ContextCheckInterval = 1024
+
+// evaluation is the state of a single call to Eval, shared by
+// everything it evaluates, including imported files
+type evaluation struct {
+	ctx      context.Context
+	opts     Options
+	builtins map[string]*object.Builtin
+	steps    int64
+	depth    int
+}
+
 // Eval will evaluate a program
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalWithOptions(context.Background(), node, env, Options{})
+}
+
+// EvalWithLimits evaluates a program like Eval, stopping it with an
+// *object.Error that has its Limit set when it takes more steps or
+// nests calls deeper than limits allow, or when ctx is done
+func EvalWithLimits(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) object.Object {
+	return EvalWithOptions(ctx, node, env, Options{Limits: limits})
+}
+
+// EvalWithOptions evaluates a program like EvalWithLimits, with the
+// limits and everything else about how it runs taken from opts
+func EvalWithOptions(ctx context.Context, node ast.Node, env *object.Environment, opts Options) object.Object {
+	ctx, opts, cancel := Prepare(ctx, opts)
+	defer cancel()
+
+	e := &evaluation{ctx: ctx, opts: opts, builtins: newBuiltins(opts.Out)}
+	return e.Eval(node, env)
+}
+
+// Eval evaluates a single node
+func (e *evaluation) Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := e.step(); err != nil {
+		return err
+	}
+
+	result := e.eval(node, env)
+
+	// errors are tagged with the position of the innermost node they came
+	// from, outer nodes leave an existing position alone
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+// step counts a node being evaluated against the step limit, and every
+// so often checks whether the context is done
+func (e *evaluation) step() *object.Error {
+	e.steps++
+
+	if e.opts.MaxSteps > 0 && e.steps > e.opts.MaxSteps {
+		return StepLimitError(e.opts.MaxSteps)
+	}
+
+	if e.steps%ContextCheckInterval == 0 {
+		if err := e.ctx.Err(); err != nil {
+			return ContextError(err)
+		}
+	}
+
+	return nil
+}
+
+func (e *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		if call, ok := node.ReturnValue.(*ast.CallExpression); ok {
+			tail := e.evalTailCall(call, env)
+			if isError(tail) {
+				return tail
+			}
+			return &object.ReturnValue{Value: tail}
+		}
+
+		val := e.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return e.evalForStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
 	// Expressions
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.BooleanLiteral:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.TemplateLiteral:
+		return e.evalTemplateLiteral(node, env)
+
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node.Operator, right, e.opts.CheckedArithmetic)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, env)
+		}
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node.Operator, left, right, e.opts.CheckedArithmetic)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
+
+	case *ast.UpdateExpression:
+		return e.evalUpdateExpression(node, env)
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := e.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
@@ -80,33 +226,44 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Env: env, Body: body, Name: node.Name}
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := e.Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		if err := checkArguments(function, args); err != nil {
+			return err
+		}
+		// the call refused by the limit was never made, so it gets no frame
+		if err := e.checkDepth(function); err != nil {
+			return err
+		}
+		result := e.applyFunction(function, args)
+		if err, ok := result.(*object.Error); ok {
+			addStackFrame(err, function, node.Function.Pos())
+		}
+		return result
 
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		index := Eval(node.Index, env)
+		index := e.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
@@ -114,7 +271,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIndexExpression(left, index)
 
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
+
+	case *ast.ImportExpression:
+		return e.evalImportExpression(node)
 	}
 
 	return nil
@@ -124,6 +284,12 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+func newLimitError(limit object.Limit, format string, a ...interface{}) *object.Error {
+	err := newError(format, a...)
+	err.Limit = limit
+	return err
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
@@ -131,15 +297,15 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *evaluation) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
-			return result.Value
+			return e.runTailCalls(result.Value)
 		case *object.Error:
 			return result
 		}
@@ -148,15 +314,15 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *evaluation) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
 				return result
 			}
 		}
@@ -165,11 +331,77 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *evaluation) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := e.Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, done := e.evalLoopBody(ws.Body, env); done {
+			return result
+		}
+	}
+}
+
+func (e *evaluation) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	if fs.Init != nil {
+		init := e.Eval(fs.Init, env)
+		if isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if fs.Condition != nil {
+			condition := e.Eval(fs.Condition, env)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		if result, done := e.evalLoopBody(fs.Body, env); done {
+			return result
+		}
+
+		if fs.Update != nil {
+			update := e.Eval(fs.Update, env)
+			if isError(update) {
+				return update
+			}
+		}
+	}
+}
+
+// evalLoopBody runs a single iteration of a loop, reporting whether the
+// loop is done along with the object the loop should evaluate to if so
+func (e *evaluation) evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := e.Eval(body, env)
+	if result == nil {
+		return nil, false
+	}
+
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	case object.BREAK_OBJ:
+		return NULL, true
+	default:
+		return nil, false
+	}
+}
+
+func (e *evaluation) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	for _, exp := range exps {
-		evaluated := Eval(exp, env)
+		evaluated := e.Eval(exp, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -179,16 +411,96 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// evalTailCall evaluates the function and arguments of a call being
+// returned, leaving the call itself to the caller's trampoline
+func (e *evaluation) evalTailCall(call *ast.CallExpression, env *object.Environment) object.Object {
+	function := e.Eval(call.Function, env)
+	if isError(function) {
+		return function
+	}
+	args := e.evalExpressions(call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+	if err := checkArguments(function, args); err != nil {
+		err.Pos = call.Pos()
+		return err
+	}
+
+	return &object.TailCall{
+		Function:  function,
+		Arguments: args,
+		Pos:       call.Pos(),
+		CalleePos: call.Function.Pos(),
+	}
+}
+
+// checkArguments reports a call of a function with fewer arguments than
+// it has parameters, before the call is made. Extra arguments are ignored
+func checkArguments(fn object.Object, args []object.Object) *object.Error {
+	if fn, ok := fn.(*object.Function); ok && len(args) < len(fn.Parameters) {
+		return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+	}
+	return nil
+}
+
+// applyFunction calls fn, then keeps making any tail calls it
+// returns in a loop, so tail recursion runs in constant stack space
+func (e *evaluation) applyFunction(fn object.Object, args []object.Object) object.Object {
+	return e.runTailCalls(e.applyFunctionOnce(fn, args))
+}
+
+func (e *evaluation) runTailCalls(result object.Object) object.Object {
+	for {
+		tail, ok := result.(*object.TailCall)
+		if !ok {
+			return result
+		}
+
+		result = e.applyFunctionOnce(tail.Function, tail.Arguments)
+
+		// the function making the tail call has already returned, so
+		// errors only get a frame for the last function tail called
+		if err, ok := result.(*object.Error); ok {
+			if !err.Pos.IsValid() {
+				err.Pos = tail.Pos
+			}
+			addStackFrame(err, tail.Function, tail.CalleePos)
+		}
+	}
+}
+
+// addStackFrame records a call of fn in the trace of err, builtins are left out
+func addStackFrame(err *object.Error, fn object.Object, pos token.Position) {
+	if fn, ok := fn.(*object.Function); ok {
+		err.Trace = append(err.Trace, object.StackFrame{Function: fn.Name, Pos: pos})
+	}
+}
+
+// checkDepth reports a call of fn that would nest more calls than the limit
+func (e *evaluation) checkDepth(fn object.Object) *object.Error {
+	if _, ok := fn.(*object.Function); ok && e.opts.MaxDepth > 0 && e.depth >= e.opts.MaxDepth {
+		return DepthLimitError(e.opts.MaxDepth)
+	}
+	return nil
+}
+
+func (e *evaluation) applyFunctionOnce(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
+		if err := e.checkDepth(fn); err != nil {
+			return err
+		}
+		e.depth++
+		defer func() { e.depth-- }()
+
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		evaluated := e.Eval(fn.Body, extendedEnv)
+		return valueOf(unwrapReturnValue(evaluated))
 
 	case *object.Builtin:
-		return fn.Fn(args...)
+		return valueOf(fn.Fn(args...))
 
 	default:
 		return newError("not a function: %s", fn.Type())
@@ -205,6 +517,15 @@ func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Enviro
 	return env
 }
 
+// valueOf returns obj, or null when it is nil because whatever produced
+// it ended without a value, like a function body ending in a let
+func valueOf(obj object.Object) object.Object {
+	if obj == nil {
+		return NULL
+	}
+	return obj
+}
+
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnVal, ok := obj.(*object.ReturnValue); ok {
 		return returnVal.Value
@@ -213,12 +534,12 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (e *evaluation) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := e.builtins[node.Value]; ok {
 		return builtin
 	}
 
@@ -232,12 +553,12 @@ func nativeBoolToBooleanObject(input bool) object.Object {
 	return FALSE
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, checked bool) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return evalMinusPrefixOperatorExpression(right, checked)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
@@ -256,22 +577,30 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 	}
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+func evalMinusPrefixOperatorExpression(right object.Object, checked bool) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		if checked && right.Value == math.MinInt64 {
+			return newError("integer overflow: -%d", right.Value)
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func evalInfixExpression(
 	operator string,
 	left, right object.Object,
+	checked bool,
 ) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, checked)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
@@ -285,26 +614,120 @@ func evalInfixExpression(
 	}
 }
 
+// evalLogicalExpression evaluates && and ||, which only evaluate their
+// right side when the left one doesn't already decide the result
+func (e *evaluation) evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := e.Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if isTruthy(left) != (node.Operator == "&&") {
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+
+	right := e.Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 func evalIntegerInfixExpression(
 	operator string,
 	left, right object.Object,
+	checked bool,
 ) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	switch operator {
+	case "+", "-", "*":
+		return evalIntegerArithmetic(operator, leftVal, rightVal, checked)
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero: %d / %d", leftVal, rightVal)
+		}
+		if checked && leftVal == math.MinInt64 && rightVal == -1 {
+			return newError("integer overflow: %d / %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero: %d %% %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalIntegerArithmetic adds, subtracts or multiplies two integers,
+// checking the result for overflow when checked is set
+func evalIntegerArithmetic(operator string, leftVal, rightVal int64, checked bool) object.Object {
+	var result int64
+	var overflow bool
+
+	switch operator {
+	case "+":
+		result = leftVal + rightVal
+		overflow = (rightVal > 0 && result < leftVal) || (rightVal < 0 && result > leftVal)
+	case "-":
+		result = leftVal - rightVal
+		overflow = (rightVal > 0 && result > leftVal) || (rightVal < 0 && result < leftVal)
+	case "*":
+		result = leftVal * rightVal
+		overflow = leftVal != 0 && (result/leftVal != rightVal ||
+			(leftVal == -1 && rightVal == math.MinInt64))
+	}
+
+	if checked && overflow {
+		return newError("integer overflow: %d %s %d", leftVal, operator, rightVal)
+	}
+
+	return &object.Integer{Value: result}
+}
+
+// evalFloatInfixExpression handles arithmetic where at least one
+// side is a float, promoting an integer on the other side to a float
+func evalFloatInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return &object.Float{Value: leftVal + rightVal}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return &object.Float{Value: leftVal - rightVal}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return &object.Float{Value: leftVal * rightVal}
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -314,6 +737,21 @@ func evalIntegerInfixExpression(
 	}
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
 func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
@@ -333,16 +771,192 @@ func evalStringInfixExpression(
 	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (e *evaluation) evalTemplateLiteral(node *ast.TemplateLiteral, env *object.Environment) object.Object {
+	var out strings.Builder
+
+	for i, exp := range node.Expressions {
+		val := e.Eval(exp, env)
+		if isError(val) {
+			return val
+		}
+
+		out.WriteString(node.Strings[i])
+		out.WriteString(valueOf(val).Inspect())
+	}
+	out.WriteString(node.Strings[len(node.Strings)-1])
+
+	return &object.String{Value: out.String()}
+}
+
+func (e *evaluation) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if node.Operator != "=" {
+			current = e.evalIdentifier(target, env)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		if current != nil {
+			val = evalCompoundAssignment(node.Operator, current, val, e.opts.CheckedArithmetic)
+			if isError(val) {
+				return val
+			}
+		}
+
+		if _, ok := env.Assign(target.Value, val); !ok {
+			return newError("identifier not found: " + target.Value)
+		}
+		return val
+
+	case *ast.IndexExpression:
+		left := e.Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := e.Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		var current object.Object
+		if node.Operator != "=" {
+			current = evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		if current != nil {
+			val = evalCompoundAssignment(node.Operator, current, val, e.opts.CheckedArithmetic)
+			if isError(val) {
+				return val
+			}
+		}
+
+		return evalIndexAssignment(left, index, val)
+
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+// evalUpdateExpression evaluates ++ and --, which work like += 1 and
+// -= 1 except that the postfix forms give the value from before
+func (e *evaluation) evalUpdateExpression(node *ast.UpdateExpression, env *object.Environment) object.Object {
+	var current, val object.Object
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		current = e.evalIdentifier(target, env)
+		if isError(current) {
+			return current
+		}
+
+		val = evalUpdate(node.Operator, current, e.opts.CheckedArithmetic)
+		if isError(val) {
+			return val
+		}
+
+		if _, ok := env.Assign(target.Value, val); !ok {
+			return newError("identifier not found: " + target.Value)
+		}
+
+	case *ast.IndexExpression:
+		left := e.Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := e.Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		current = evalIndexExpression(left, index)
+		if isError(current) {
+			return current
+		}
+
+		val = evalUpdate(node.Operator, current, e.opts.CheckedArithmetic)
+		if isError(val) {
+			return val
+		}
+
+		if err := evalIndexAssignment(left, index, val); isError(err) {
+			return err
+		}
+
+	default:
+		return newError("cannot apply %s to %s", node.Operator, node.Target.String())
+	}
+
+	if node.Prefix {
+		return val
+	}
+	return current
+}
+
+// evalUpdate adds one to or subtracts one from current, for ++ or --
+func evalUpdate(operator string, current object.Object, checked bool) object.Object {
+	return evalInfixExpression(operator[:1], current, &object.Integer{Value: 1}, checked)
+}
+
+// evalCompoundAssignment applies the operator of a compound
+// assignment such as += to the current and new values
+func evalCompoundAssignment(operator string, current, val object.Object, checked bool) object.Object {
+	return evalInfixExpression(strings.TrimSuffix(operator, "="), current, val, checked)
+}
+
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		arrayObj := left.(*object.Array)
+		idx := index.(*object.Integer).Value
+		length := int64(len(arrayObj.Elements))
+
+		if idx < 0 || idx >= length {
+			return newError("index out of range: %d with length %d", idx, length)
+		}
+
+		arrayObj.Elements[idx] = val
+		return val
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("invalid hash key: %s", index.Type())
+		}
+
+		left.(*object.Hash).Set(key, val)
+		return val
+	default:
+		return newError("index assignment not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+func (e *evaluation) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return valueOf(e.Eval(ie.Consequence, env))
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return valueOf(e.Eval(ie.Alternative, env))
 	} else {
 		return NULL
 	}
@@ -365,7 +979,7 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
-	case left.Type() == object.HASH_OBJ && index.Type() == object.STRING_OBJ:
+	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
 		return newError("index operator not supported: %s[%s]", left.Type(), index.Type())
@@ -386,9 +1000,13 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObj := hash.(*object.Hash)
-	key := index.(*object.String).Value
 
-	value, ok := hashObj.Pairs[key]
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("index operator not supported: %s[%s]", hash.Type(), index.Type())
+	}
+
+	value, ok := hashObj.Get(key)
 	if !ok {
 		return NULL
 	}
@@ -396,27 +1014,27 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return value
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[string]object.Object)
+func (e *evaluation) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	for _, pair := range node.Pairs {
+		key := e.Eval(pair.Key, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(*object.String)
+		hashKey, ok := key.(object.Hashable)
 		if !ok {
 			return newError("invalid hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := e.Eval(pair.Value, env)
 		if isError(value) {
 			return value
 		}
 
-		pairs[hashKey.Value] = value
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
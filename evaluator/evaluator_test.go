@@ -1,20 +1,58 @@
 package evaluator
 
 import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ASteinheiser/amoeba-interpreter/lexer"
 	"github.com/ASteinheiser/amoeba-interpreter/object"
 	"github.com/ASteinheiser/amoeba-interpreter/parser"
+	"github.com/ASteinheiser/amoeba-interpreter/token"
 )
 
-func testEval(input string) object.Object {
+// Engines are the other ways of running a program. Every program the
+// tests evaluate is run with each of them too, and has to give the same
+// result. engines_test.go adds the vm, which can't be imported from here
+var Engines = map[string]func(input string, opts Options) object.Object{}
+
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	return testEvalWithOptions(t, input, Options{})
+}
+
+func testEvalWithOptions(t *testing.T, input string, opts Options) object.Object {
+	t.Helper()
+	evaluated := evalWithOptions(input, opts)
+
+	for name, run := range Engines {
+		expected := inspect(evaluated)
+		if actual := inspect(run(input, opts)); actual != expected {
+			t.Errorf("%s result differs for %q.\nexpected=%s\ngot=%s", name, input, expected, actual)
+		}
+	}
+
+	return evaluated
+}
+
+func evalWithOptions(input string, opts Options) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
 	env := object.NewEnvironment()
 
-	return Eval(program, env)
+	return EvalWithOptions(context.Background(), program, env, opts)
+}
+
+// inspect describes a result well enough to tell any two apart
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return string(obj.Type()) + " " + obj.Inspect()
 }
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -35,10 +73,14 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"40 / 2 * 4 + -10", 70},
 		{"40 * (4 - 3) / 4", 10},
 		{"(4 + 6 * 2 + 12 / 4) * 2 + -10", 28},
+		{"17 % 5", 2},
+		{"-17 % 5", -2},
+		{"2 + 17 % 5 * 3", 8},
+		{"let x = 17; x %= 4; x", 1},
 	}
 
 	for _, test := range tests {
-		evaluated := testEval(test.input)
+		evaluated := testEval(t, test.input)
 		testIntegerObject(t, evaluated, test.expected)
 	}
 }
@@ -58,6 +100,68 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"2.5", 2.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.25", 2.75},
+		{"7 / 2.0", 3.5},
+		{"7.0 / 2", 3.5},
+		{"2 * 0.25 + 1", 1.5},
+		{"10 - 0.5 * 3", 8.5},
+		{"let x = 1; x += 0.5; x", 1.5},
+		{"float(7) / 2", 3.5},
+		{`float("2.75")`, 2.75},
+		{"float(1.5)", 1.5},
+		{"7.5 % 2", 1.5},
+		{"-7 % 2.5", -2},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+		testFloatObject(t, evaluated, test.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("obj not of type *object.Float, got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("expected obj.Value to be %g, got=%g", expected, result.Value)
+		return false
+	}
+
+	return true
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5", "1.5"},
+		{"3.0", "3.0"},
+		{"6 / 2.0", "3.0"},
+		{"-0.25", "-0.25"},
+		{"1.0 / 0", "+Inf"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("Inspect() wrong for %q. expected=%q, got=%q",
+				test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -82,14 +186,25 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
 		{"(1 > 2) == true", false},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"1.5 != 1.5", false},
 		{`"hello" == "hello"`, true},
 		{`"hello" == "world"`, false},
 		{`"hello" != "hello"`, false},
 		{`"hello" != "world"`, true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"1.5 >= 1", true},
+		{"2 <= 1.5", false},
 	}
 
 	for _, test := range tests {
-		evaluated := testEval(test.input)
+		evaluated := testEval(t, test.input)
 		testBooleanObject(t, evaluated, test.expected)
 	}
 }
@@ -123,7 +238,34 @@ func TestEvalBangOperator(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		evaluated := testEval(test.input)
+		evaluated := testEval(t, test.input)
+		testBooleanObject(t, evaluated, test.expected)
+	}
+}
+
+func TestEvalLogicalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"true || false", true},
+		{"false || false", false},
+		{"false || true", true},
+		{"1 && \"a\"", true},
+		{"if (false) { 1 } || 0", true},
+		{"1 < 2 && 2 < 3 || false", true},
+		{"!true || !false && false", false},
+		// the right side is left alone when the left one decides
+		{"false && undefinedName", false},
+		{"true || 1 / 0", true},
+		{"let n = 0; let bump = fn() { n += 1; true }; false && bump(); true || bump(); n == 0", true},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
 		testBooleanObject(t, evaluated, test.expected)
 	}
 }
@@ -140,10 +282,12 @@ func TestEvalIfElseExpression(t *testing.T) {
 		{"if(1 > 2) { 10 }", nil},
 		{"if(1 > 2) { 10 } else { 20 }", 20},
 		{"if(1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { let x = 1 }", nil},
+		{"if (false) { 1 } else {}", nil},
 	}
 
 	for _, test := range tests {
-		evaluated := testEval(test.input)
+		evaluated := testEval(t, test.input)
 		integer, ok := test.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -184,7 +328,7 @@ func TestEvalReturnStatements(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		evaluated := testEval(test.input)
+		evaluated := testEval(t, test.input)
 		testIntegerObject(t, evaluated, test.expected)
 	}
 }
@@ -206,6 +350,10 @@ func TestErrorHandling(t *testing.T) {
 			"-true;",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"1.5 + true;",
+			"type mismatch: FLOAT + BOOLEAN",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -249,20 +397,28 @@ func TestErrorHandling(t *testing.T) {
 			"unknown operator: STRING - STRING",
 		},
 		{
-			`{12: "something"}`,
-			"invalid hash key: INTEGER",
+			`"a" <= "b"`,
+			"unknown operator: STRING <= STRING",
 		},
 		{
-			`{true: "something"}`,
-			"invalid hash key: BOOLEAN",
+			"true && 1 + false",
+			"type mismatch: INTEGER + BOOLEAN",
 		},
 		{
-			`{"foo": 4}[true]`,
-			"index operator not supported: HASH[BOOLEAN]",
+			`"sum: ${1 + true}"`,
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			`{fn(x) { x }: "something"}`,
+			"invalid hash key: FUNCTION",
+		},
+		{
+			`{[1]: "something"}`,
+			"invalid hash key: ARRAY",
 		},
 		{
-			`{"foo": 4}[7]`,
-			"index operator not supported: HASH[INTEGER]",
+			`{"foo": 4}[[1]]`,
+			"index operator not supported: HASH[ARRAY]",
 		},
 		{
 			`{"foo": 4}[fn(x) {x + x}]`,
@@ -271,7 +427,7 @@ func TestErrorHandling(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		evaluated := testEval(test.input)
+		evaluated := testEval(t, test.input)
 
 		errObj, ok := evaluated.(*object.Error)
 		if !ok {
@@ -285,6 +441,43 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestWrongNumberOfArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let f = fn(a, b) { a + b }; f(1)",
+			"ERROR: 1:30: wrong number of arguments: want=2, got=1",
+		},
+		{
+			"let f = fn(x) { x }; f()",
+			"ERROR: 1:23: wrong number of arguments: want=1, got=0",
+		},
+		{
+			"let f = fn(a, b) { a + b };\nlet g = fn() { return f(1) };\ng()",
+			"ERROR: 2:24: wrong number of arguments: want=2, got=1\n    in g, called at 3:1",
+		},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("errObj not of type *object.Error, got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Inspect() != test.expected {
+			t.Errorf("errObj.Inspect() wrong. expected=%q, got=%q", test.expected, errObj.Inspect())
+		}
+	}
+
+	// arguments past the parameters are ignored
+	testIntegerObject(t, testEval(t, "let f = fn(x) { x }; f(1, 2)"), 1)
+}
+
 func TestEvalLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -297,7 +490,7 @@ func TestEvalLetStatements(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		testIntegerObject(t, testEval(test.input), test.expected)
+		testIntegerObject(t, testEval(t, test.input), test.expected)
 	}
 }
 
@@ -306,7 +499,7 @@ func TestEvalFunctionExpression(t *testing.T) {
 	expectedParam := "y"
 	expectedBody := "(y + 4)"
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	fn, ok := evaluated.(*object.Function)
 	if !ok {
 		t.Fatalf("fn not of type *object.Function, got=%T (%+v)", evaluated, evaluated)
@@ -339,7 +532,7 @@ func TestEvalFunctionCall(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		testIntegerObject(t, testEval(test.input), test.expected)
+		testIntegerObject(t, testEval(t, test.input), test.expected)
 	}
 }
 
@@ -352,7 +545,266 @@ func TestClosures(t *testing.T) {
 		addFour(6)
 	`
 
-	testIntegerObject(t, testEval(input), 10)
+	testIntegerObject(t, testEval(t, input), 10)
+}
+
+func TestScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn() { g() }; let g = fn() { 5 }; f()", "5"},
+		{"let outer = fn() { let get = fn() { later }; let later = 3; get() }; outer()", "3"},
+		{"let x = 1; let f = fn() { let x = x + 1; x }; [f(), x]", "[2, 1]"},
+		{"let x = 1; let f = fn() { x = x + 1; let x = 10; x = x + 1; x }; [f(), x]", "[11, 2]"},
+		{"let add = fn(a) { fn(b) { a + b } }; let addTwo = add(2); addTwo(3)", "5"},
+		{`let h = {"n": 1}; let bump = fn(h) { h["n"] += 1 }; bump(h); bump(h); h`, `{"n": 3}`},
+		{"let count = 0; let f = fn() { for (;;) { count += 1; if (count > 2) { return count } } }; f() + f()", "7"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("wrong result for %q, expected=%s, got=%s", test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestValuelessBodies(t *testing.T) {
+	tests := []string{
+		"fn() {}()",
+		"let f = fn() {}; let x = f(); x",
+		"let f = fn() { let y = 1 }; let x = f(); x",
+		"let f = fn() { if (false) { 1 } }; let x = f(); [x][0]",
+	}
+
+	for _, input := range tests {
+		testNullObject(t, testEval(t, input))
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`
+			let count = fn(n, acc) {
+				if (n == 0) { return acc }
+				return count(n - 1, acc + 1)
+			}
+			count(1000000, 0)
+			`,
+			1000000,
+		},
+		{
+			`
+			let sumArray = fn(arr, i, acc) {
+				if (i == len(arr)) {
+					return acc
+				} else {
+					return sumArray(arr, i + 1, acc + arr[i])
+				}
+			}
+			let arr = [1, 2, 3, 4, 5];
+			sumArray(arr, 0, 0)
+			`,
+			15,
+		},
+		{
+			`
+			let isEven = fn(n) { if (n == 0) { return true } return isOdd(n - 1) }
+			let isOdd = fn(n) { if (n == 0) { return false } return isEven(n - 1) }
+			if (isEven(300001)) { 1 } else { 0 }
+			`,
+			0,
+		},
+		{
+			`
+			let isEven = fn(n) { if (n == 0) { return true } return isOdd(n - 1) }
+			let isOdd = fn(n) { if (n == 0) { return false } return isEven(n - 1) }
+			if (isOdd(300001)) { 1 } else { 0 }
+			`,
+			1,
+		},
+		{"let f = fn(x) { return len(x) }; f([1, 2])", 2},
+		{"let f = fn(x) { return fn(y) { x + y } }; f(2)(3)", 5},
+		{"let double = fn(x) { x * 2 }; return double(4)", 8},
+	}
+
+	for _, test := range tests {
+		testIntegerObject(t, testEval(t, test.input), test.expected)
+	}
+}
+
+func TestTailCallErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let f = fn(x) {\n  return len(x)\n};\nf(1)",
+			"ERROR: 2:13: argument to `len` not supported: INTEGER\n    in f, called at 4:1",
+		},
+		{
+			"let f = fn() {\n  return 5()\n};\nf()",
+			"ERROR: 2:11: not a function: INTEGER\n    in f, called at 4:1",
+		},
+		{
+			"let g = fn() {\n  1 + true\n};\nlet f = fn() {\n  return g()\n};\nf()",
+			"ERROR: 2:5: type mismatch: INTEGER + BOOLEAN\n    in g, called at 5:10\n    in f, called at 7:1",
+		},
+		{
+			"let g = fn() {\n  1 + true\n};\nreturn g()",
+			"ERROR: 2:5: type mismatch: INTEGER + BOOLEAN\n    in g, called at 4:8",
+		},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("errObj not of type *object.Error, got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Inspect() != test.expected {
+			t.Errorf("errObj.Inspect() wrong. expected=%q, got=%q", test.expected, errObj.Inspect())
+		}
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   Limits
+		limit    object.Limit
+		expected string
+	}{
+		{
+			"while (true) {}",
+			Limits{MaxSteps: 1000},
+			object.StepLimit,
+			"step limit exceeded: more than 1000 steps",
+		},
+		{
+			"let f = fn(x) { 1 + f(x) };\nf(1)",
+			Limits{MaxDepth: 100},
+			object.DepthLimit,
+			"call depth limit exceeded: more than 100 nested calls",
+		},
+		{
+			"let x = 0; while (x < 100) { x += 1 }; x",
+			Limits{MaxSteps: 10},
+			object.StepLimit,
+			"step limit exceeded: more than 10 steps",
+		},
+		{
+			"let f = fn() { f() }; f()",
+			Limits{},
+			object.DepthLimit,
+			"call depth limit exceeded: more than 10000 nested calls",
+		},
+		{
+			"while (true) {}",
+			Limits{Timeout: time.Millisecond},
+			object.ContextLimit,
+			"evaluation stopped: context deadline exceeded",
+		},
+		{
+			// calls in imported files count on top of the ones importing them
+			`let f = fn(n) { if (n > 0) { f(n - 1) } else { import "testdata/deep.amoeba" } }; f(5)`,
+			Limits{MaxDepth: 8},
+			object.DepthLimit,
+			"call depth limit exceeded: more than 8 nested calls",
+		},
+	}
+
+	for _, test := range tests {
+		program := parser.New(lexer.New(test.input)).ParseProgram()
+		evaluated := EvalWithLimits(context.Background(), program, object.NewEnvironment(), test.limits)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("errObj not of type *object.Error, got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Limit != test.limit {
+			t.Errorf("errObj.Limit wrong. expected=%q, got=%q", test.limit, errObj.Limit)
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("errObj.Message wrong. expected=%q, got=%q", test.expected, errObj.Message)
+		}
+	}
+}
+
+func TestDepthLimitTrace(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected string
+	}{
+		{
+			"let f = fn(n) { 1 + f(n) }; f(1);",
+			Limits{},
+			"ERROR: 1:22: call depth limit exceeded: more than 10000 nested calls\n" +
+				"    in f, called at 1:21\n    ... repeated 9998 more times\n    in f, called at 1:29",
+		},
+		{
+			"let f = fn(n) { if (n > 0) { f(n - 1) } else { f(n) + 1 } }; f(2)",
+			Limits{MaxDepth: 4},
+			"ERROR: 1:49: call depth limit exceeded: more than 4 nested calls\n" +
+				"    in f, called at 1:48\n    in f, called at 1:30\n    ... repeated 1 more times\n    in f, called at 1:62",
+		},
+	}
+
+	// the call refused by the limit was never made, so neither engine
+	// gives it a frame
+	for _, test := range tests {
+		evaluated := testEvalWithOptions(t, test.input, Options{Limits: test.limits})
+		if actual := evaluated.Inspect(); actual != test.expected {
+			t.Errorf("trace wrong for %q. expected=\n%s\ngot=\n%s", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestExecutionWithinLimits(t *testing.T) {
+	input := `
+let countdown = fn(n) { if (n == 0) { return 0 }; return countdown(n - 1) };
+let fib = fn(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) };
+countdown(10000) + fib(10)
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	limits := Limits{MaxSteps: 1000000, MaxDepth: 20}
+
+	// tail calls don't nest, so the countdown stays well within the depth limit
+	evaluated := EvalWithLimits(context.Background(), program, object.NewEnvironment(), limits)
+	testIntegerObject(t, evaluated, 55)
+}
+
+func TestExecutionContext(t *testing.T) {
+	program := parser.New(lexer.New("while (true) {}")).ParseProgram()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	evaluated := EvalWithLimits(ctx, program, object.NewEnvironment(), Limits{})
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("errObj not of type *object.Error, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Limit != object.ContextLimit {
+		t.Errorf("errObj.Limit wrong. expected=%q, got=%q", object.ContextLimit, errObj.Limit)
+	}
+	expected := "ERROR: 1:1: evaluation stopped: context deadline exceeded"
+	if errObj.Inspect() != expected {
+		t.Errorf("errObj.Inspect() wrong. expected=%q, got=%q", expected, errObj.Inspect())
+	}
 }
 
 func testStringObject(t *testing.T, obj object.Object, expected string) bool {
@@ -374,7 +826,7 @@ func TestEvalStringExpression(t *testing.T) {
 	input := `"Hello world!"`
 	expected := "Hello world!"
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 
 	testStringObject(t, evaluated, expected)
 }
@@ -383,11 +835,50 @@ func TestEvalStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 	expected := "Hello World!"
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 
 	testStringObject(t, evaluated, expected)
 }
 
+func TestEvalStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"tab\there"`, "tab\there"},
+		{`"\"quoted\" \\ \u{1F600}"`, "\"quoted\" \\ 😀"},
+		{"`raw \\n\nstring`", "raw \\n\nstring"},
+		{"`a` + \"\\n\" + `b`", "a\nb"},
+	}
+
+	for _, test := range tests {
+		testStringObject(t, testEval(t, test.input), test.expected)
+	}
+}
+
+func TestEvalStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"total: ${1 + 2}"`, "total: 3"},
+		{`let name = "amoeba"; "hi ${name}, ${len(name)}!"`, "hi amoeba, 6!"},
+		{`"${[1, "two"]} ${{"k": true}} ${1.5}"`, `[1, "two"] {"k": true} 1.5`},
+		{`let f = fn(x) { "<${x}>" }; "${f("${f(1)}")}"`, "<<1>>"},
+		{`"${"}"}{}"`, "}{}"},
+		{`"\${x} $x $"`, "${x} $x $"},
+		{`"${ {"a": 1}["a"] }"`, "1"},
+		{"`${raw}`", "${raw}"},
+		{`let f = fn() {}; "${f()}"`, "null"},
+		{`"<${if (true) {}}>"`, "<null>"},
+		{`"${if (true) { let x = 1 }}"`, "null"},
+	}
+
+	for _, test := range tests {
+		testStringObject(t, testEval(t, test.input), test.expected)
+	}
+}
+
 func TestEvalBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -396,6 +887,9 @@ func TestEvalBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len(" hey world ! ")`, 13},
+		{`len("héllo")`, 5},
+		{`len("\u{1F600}!")`, 2},
+		{"len(`two\nlines`)", 9},
 		{`len([])`, 0},
 		{`len([1, 2, 3, 4])`, 4},
 		{`len(["sup", 2, true, 4 + 7])`, 4},
@@ -424,10 +918,24 @@ func TestEvalBuiltinFunctions(t *testing.T) {
 		{`push("yo!", 5)`, "first argument to `push` must be ARRAY, got STRING"},
 		{`push([1, 2])`, "wrong number of arguments passed to `push`: got 1, want 2"},
 		{`push([1, 2], 1, true)`, "wrong number of arguments passed to `push`: got 3, want 2"},
+		{`int(7)`, 7},
+		{`int(3.9)`, 3},
+		{`int(-3.9)`, -3},
+		{`int("42")`, 42},
+		{`int("4.2")`, "could not parse \"4.2\" as an integer"},
+		{`int(true)`, "argument to `int` not supported: BOOLEAN"},
+		{`int(1, 2)`, "wrong number of arguments passed to `int`: got 2, want 1"},
+		{`float("abc")`, "could not parse \"abc\" as a float"},
+		{`float([])`, "argument to `float` not supported: ARRAY"},
+		{`float()`, "wrong number of arguments passed to `float`: got 0, want 1"},
+		{`assert(1 < 2)`, nil},
+		{`assert(1 > 2)`, "assertion failed"},
+		{`assert(false, "numbers are broken")`, "assertion failed: numbers are broken"},
+		{`assert()`, "wrong number of arguments passed to `assert`: got 0, want 1 or 2"},
 	}
 
 	for _, test := range tests {
-		evaluated := testEval(test.input)
+		evaluated := testEval(t, test.input)
 
 		switch expected := test.expected.(type) {
 		case int:
@@ -457,7 +965,7 @@ func TestEvalBuiltinFunctions(t *testing.T) {
 func TestEvalArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 4, 5 + 8]"
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	array, ok := evaluated.(*object.Array)
 	if !ok {
 		t.Fatalf("array not of type *object.Array, got=%T (%+v)", evaluated, evaluated)
@@ -490,7 +998,7 @@ func TestEvalArrayIndexExpessions(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		evaluated := testEval(test.input)
+		evaluated := testEval(t, test.input)
 
 		integer, ok := test.expected.(int)
 		if ok {
@@ -507,20 +1015,26 @@ func TestEvalHashLiterals(t *testing.T) {
 		{
 			"one": 1,
 			two: 1 + 1,
-			"thr" + "ee": 6 / 2
+			"thr" + "ee": 6 / 2,
+			4: 4,
+			true: 5,
+			false: 6
 		}
 	`
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	hash, ok := evaluated.(*object.Hash)
 	if !ok {
 		t.Fatalf("hash not of type *object.Hash, got=%T (%+v)", evaluated, evaluated)
 	}
 
-	expected := map[string]int64{
-		"one":   1,
-		"two":   2,
-		"three": 3,
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
 	}
 
 	if len(hash.Pairs) != len(expected) {
@@ -528,12 +1042,46 @@ func TestEvalHashLiterals(t *testing.T) {
 	}
 
 	for expectedKey, expectedVal := range expected {
-		value, ok := hash.Pairs[expectedKey]
+		pair, ok := hash.Pairs[expectedKey]
 		if !ok {
-			t.Errorf("no value found for key=%s", expectedKey)
+			t.Errorf("no pair found for key=%+v", expectedKey)
 		}
 
-		testIntegerObject(t, value, expectedVal)
+		testIntegerObject(t, pair.Value, expectedVal)
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	hello1 := &object.String{Value: "Hello World"}
+	hello2 := &object.String{Value: "Hello World"}
+	diff := &object.String{Value: "My name is johnny"}
+	one := &object.Integer{Value: 1}
+	oneString := &object.String{Value: "1"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+
+	if one.HashKey() == oneString.HashKey() {
+		t.Errorf("integer and string with the same text have same hash keys")
+	}
+
+	if (&object.Integer{Value: 1}).HashKey() == TRUE.HashKey() {
+		t.Errorf("integer 1 and true have same hash keys")
+	}
+
+	// strings are keyed by all of their text, so different ones never collide
+	seen := make(map[object.HashKey]string)
+	for i := 0; i < 100000; i++ {
+		s := &object.String{Value: strconv.Itoa(i)}
+		if other, ok := seen[s.HashKey()]; ok {
+			t.Fatalf("strings %q and %q have same hash keys", other, s.Value)
+		}
+		seen[s.HashKey()] = s.Value
 	}
 }
 
@@ -562,10 +1110,34 @@ func TestEvalHashIndexExpessions(t *testing.T) {
 			`{}["key1"]`,
 			nil,
 		},
+		{
+			`{4: 7}[4]`,
+			7,
+		},
+		{
+			`{"4": 7}[4]`,
+			nil,
+		},
+		{
+			`{true: 7}[true]`,
+			7,
+		},
+		{
+			`{false: 7}[1 > 2]`,
+			7,
+		},
+		{
+			`{"foo": 4}[true]`,
+			nil,
+		},
+		{
+			`{1: "a", "1": 2}["1"]`,
+			2,
+		},
 	}
 
 	for _, test := range tests {
-		evaluated := testEval(test.input)
+		evaluated := testEval(t, test.input)
 
 		integer, ok := test.expected.(int)
 		if ok {
@@ -575,3 +1147,481 @@ func TestEvalHashIndexExpessions(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"4 + false;", "ERROR: 1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 4;\n\n  missing;", "ERROR: 3:3: identifier not found: missing"},
+		{"let f = fn(a) {\n  -a\n};\nf(true)", "ERROR: 2:3: unknown operator: -BOOLEAN\n    in f, called at 4:1"},
+		{"let a = 1;\nlen(a)", "ERROR: 2:4: argument to `len` not supported: INTEGER"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("errObj not of type *object.Error, got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Inspect() != test.expected {
+			t.Errorf("expected errObj.Inspect() to be %q, got=%q", test.expected, errObj.Inspect())
+		}
+	}
+}
+
+func TestErrorStackTraces(t *testing.T) {
+	input := `
+let inner = fn(x) {
+  x + true
+}
+let outer = fn(x) {
+  inner(x)
+}
+let countdown = fn(n) {
+  if (n == 0) { return outer(n) }
+  countdown(n - 1)
+}
+fn() { countdown(3) }()
+`
+
+	expected := []object.StackFrame{
+		{Function: "inner", Pos: token.Position{Line: 6, Column: 3}},
+		{Function: "outer", Pos: token.Position{Line: 9, Column: 24}},
+		{Function: "countdown", Pos: token.Position{Line: 10, Column: 3}},
+		{Function: "countdown", Pos: token.Position{Line: 10, Column: 3}},
+		{Function: "countdown", Pos: token.Position{Line: 10, Column: 3}},
+		{Function: "countdown", Pos: token.Position{Line: 12, Column: 8}},
+		{Function: "", Pos: token.Position{Line: 12, Column: 1}},
+	}
+
+	evaluated := testEval(t, input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("errObj not of type *object.Error, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(errObj.Trace) != len(expected) {
+		t.Fatalf("trace has wrong number of frames. expected=%d, got=%d (%+v)",
+			len(expected), len(errObj.Trace), errObj.Trace)
+	}
+
+	for i, frame := range expected {
+		if errObj.Trace[i] != frame {
+			t.Errorf("frame [%d] wrong. expected=%+v, got=%+v", i, frame, errObj.Trace[i])
+		}
+	}
+
+	expectedInspect := `ERROR: 3:5: type mismatch: INTEGER + BOOLEAN
+    in inner, called at 6:3
+    in outer, called at 9:24
+    in countdown, called at 10:3
+    ... repeated 2 more times
+    in countdown, called at 12:8
+    in <anonymous fn>, called at 12:1`
+
+	if errObj.Inspect() != expectedInspect {
+		t.Errorf("errObj.Inspect() wrong. expected=\n%s\ngot=\n%s", expectedInspect, errObj.Inspect())
+	}
+}
+
+func TestEvalWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { let i = i + 1 }; i", 10},
+		{"let i = 0; while (false) { let i = i + 1 }; i", 0},
+		{"let i = 0; while (true) { if (i == 5) { break } let i = i + 1 }; i", 5},
+		{
+			`
+			let i = 0;
+			let odds = 0;
+			while (i < 10) {
+				let i = i + 1;
+				if (i - (i / 2) * 2 == 0) { continue; }
+				let odds = odds + 1;
+			}
+			odds
+			`,
+			5,
+		},
+		{"let f = fn() { while (true) { return 7 } }; f()", 7},
+		{"while (false) { 1 }", nil},
+		{"let i = 0; while (i < 100000) { let i = i + 1 }; i", 100000},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+
+		integer, ok := test.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestEvalForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (let i = 0; i < 5; let i = i + 1) { let sum = sum + i }; sum", 10},
+		{
+			`
+			let sum = 0;
+			for (let i = 0; i < 10; let i = i + 1) {
+				if (i == 3) { continue }
+				if (i == 7) { break }
+				let sum = sum + i
+			}
+			sum
+			`,
+			18,
+		},
+		{"let i = 0; for (; i < 3; ) { let i = i + 1 }; i", 3},
+		{"let i = 0; for (;;) { let i = i + 1; if (i > 4) { break } }; i", 5},
+		{
+			`
+			let count = 0;
+			for (let i = 0; i < 3; let i = i + 1) {
+				for (let j = 0; j < 3; let j = j + 1) {
+					if (j == 1) { break }
+					let count = count + 1
+				}
+			}
+			count
+			`,
+			3,
+		},
+		{"let f = fn(arr) { for (let i = 0; i < len(arr); let i = i + 1) { if (arr[i] > 2) { return arr[i] } } }; f([1, 2, 3, 4])", 3},
+		{"for (let i = 0; i < 3; let i = i + 1) { i }", nil},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+
+		integer, ok := test.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestEvalAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = 5", 5},
+		{"let x = 1; let y = 2; x = y = 7; x + y", 14},
+		{"let x = 10; x += 5; x", 15},
+		{"let x = 10; x -= 5; x", 5},
+		{"let x = 10; x *= 5; x", 50},
+		{"let x = 10; x /= 5; x", 2},
+		{"let s = \"a\"; s += \"b\"; s", "ab"},
+		{"let x = 1; let f = fn() { x = x + 1 }; f(); f(); x", 3},
+		{"let x = 1; let f = fn(x) { x = 10 }; f(2); x", 1},
+		{
+			`
+			let newCounter = fn() {
+				let count = 0;
+				fn() { count += 1 }
+			}
+			let counter = newCounter();
+			counter();
+			counter();
+			counter()
+			`,
+			3,
+		},
+		{"let total = 0; for (let i = 1; i < 5; i += 1) { total += i }; total", 10},
+		{"let total = 0; for (let i = 0; i < 4; i = i + 1) { total = total + i }; total", 6},
+		{"let arr = [1, 2, 3]; arr[1] = 7; arr[1]", 7},
+		{"let arr = [1, 2, 3]; arr[2] += 7; arr[2]", 10},
+		{"let arr = [[1], [2]]; arr[1][0] = 5; arr[1][0]", 5},
+		{"let h = {\"a\": 1}; h[\"a\"] = 2; h[\"a\"]", 2},
+		{"let h = {}; h[\"b\"] = 3; h[\"b\"]", 3},
+		{"let h = {\"a\": 1}; h[\"a\"] *= 4; h[\"a\"]", 4},
+		{"let x = 1; let f = fn() { x = 10; 1 }; x += f(); x", 2},
+		{"let arr = [1]; let f = fn() { arr[0] = 10; 1 }; arr[0] += f(); arr[0]", 2},
+		{"let h = {\"a\": 1}; let f = fn() { h[\"a\"] = 10; 1 }; h[\"a\"] += f(); h[\"a\"]", 2},
+		{"x = 4", "identifier not found: x"},
+		{"let x = 1; y += x", "identifier not found: y"},
+		{"let x = 1; x += true", "type mismatch: INTEGER + BOOLEAN"},
+		{"let arr = [1]; arr[1] = 2", "index out of range: 1 with length 1"},
+		{"let arr = [1]; arr[-1] = 2", "index out of range: -1 with length 1"},
+		{"let h = {}; h[1] = 2; h[1]", 2},
+		{"let h = {}; h[true] = 2; h[true]", 2},
+		{"let h = {}; h[[1]] = 2", "invalid hash key: ARRAY"},
+		{"let s = \"abc\"; s[0] = 2", "index assignment not supported: STRING[INTEGER]"},
+		{"let h = {}; h[\"a\"] += 1", "type mismatch: NULL + INTEGER"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("errObj.Message is wrong. expected=%q, got=%q", expected, errObj.Message)
+				}
+				continue
+			}
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestEvalUpdateExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x++", 1},
+		{"let x = 1; x++; x", 2},
+		{"let x = 1; ++x", 2},
+		{"let x = 1; x--", 1},
+		{"let x = 1; --x; x", 0},
+		{"let x = 1; let y = x++ + x; y", 3},
+		{"let x = 1; -x++", -1},
+		{"let x = 1.5; x++; x", 2.5},
+		{"let arr = [1, 2]; arr[1]++", 2},
+		{"let arr = [1, 2]; arr[1]++; arr", "[1, 3]"},
+		{"let arr = [1, 2]; ++arr[0]", 2},
+		{"let h = {\"a\": 1}; h[\"a\"]--; h[\"a\"]", 0},
+		{"let i = 0; let arr = [10, 20]; arr[i++]++; [i, arr]", "[1, [11, 20]]"},
+		{"let n = 0; let f = fn() { n++ }; f(); f(); n", 2},
+		{"let total = 0; for (let i = 0; i < 4; i++) { total += i }; total", 6},
+		{"x++", "identifier not found: x"},
+		{"let s = \"a\"; s++", "type mismatch: STRING + INTEGER"},
+		{"let t = true; --t", "type mismatch: BOOLEAN - INTEGER"},
+		{"let h = {}; h[\"a\"]++", "type mismatch: NULL + INTEGER"},
+		{"let arr = [1]; arr[5]++", "type mismatch: NULL + INTEGER"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("errObj.Message is wrong. expected=%q, got=%q", expected, errObj.Message)
+				}
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%q", test.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 / 0", "division by zero: 1 / 0"},
+		{"let x = 0; 10 / x", "division by zero: 10 / 0"},
+		{"let x = 4; x /= 0", "division by zero: 4 / 0"},
+		{"let f = fn(a) { a / (a - a) }; f(7)", "division by zero: 7 / 0"},
+		{"5 % 0", "division by zero: 5 % 0"},
+		{"let x = 4; x %= 0", "division by zero: 4 % 0"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("errObj not of type *object.Error, got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != test.expectedMessage {
+			t.Errorf("expected errObj.Message to be %q, got=%q", test.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"-1 * (-9223372036854775807 - 1)", "integer overflow: -1 * -9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: --9223372036854775808"},
+		{"let x = 9223372036854775807; x += 1", "integer overflow: 9223372036854775807 + 1"},
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-9223372036854775807 - 1", -9223372036854775808},
+		{"-4611686018427387904 * 2", -9223372036854775808},
+		{"3037000499 * 3037000499", 9223372030926249001},
+	}
+
+	for _, test := range tests {
+		evaluated := testEvalWithOptions(t, test.input, Options{CheckedArithmetic: true})
+
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("errObj not of type *object.Error, got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("expected errObj.Message to be %q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestUncheckedArithmeticWraps(t *testing.T) {
+	testIntegerObject(t, testEval(t, "9223372036854775807 + 1"), -9223372036854775808)
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: 3, true: 4}`, `{"b": 1, "a": 2, 3: 3, true: 4}`},
+		{`{"z": 1, "y": 2, "x": 3, "w": 4, "v": 5, "u": 6}`, `{"z": 1, "y": 2, "x": 3, "w": 4, "v": 5, "u": 6}`},
+		{`let h = {"b": 1}; h["a"] = 2; h["c"] = 3; h`, `{"b": 1, "a": 2, "c": 3}`},
+		{`let h = {"b": 1, "a": 2}; h["b"] = 7; h`, `{"b": 7, "a": 2}`},
+		{`{"a": 1, "b": 2, "a": 3}`, `{"a": 3, "b": 2}`},
+	}
+
+	for _, test := range tests {
+		// run each case a few times, since go map iteration order is randomized
+		for i := 0; i < 10; i++ {
+			evaluated := testEval(t, test.input)
+			if evaluated.Inspect() != test.expected {
+				t.Fatalf("Inspect() wrong for %q. expected=%q, got=%q",
+					test.input, test.expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestImportExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let math = import "testdata/math.amoeba"; math["square"](7)`, 49},
+		{`let math = import "testdata/math.amoeba"; math["sumArray"]([1, 2, 3, 4])`, 10},
+		{`import "testdata/math.amoeba"["missing"]`, nil},
+		{`let geometry = import "testdata/geometry.amoeba"; geometry["area"](3)`, 9},
+		{
+			`
+			let first = import "testdata/math.amoeba";
+			first["state"][0] = 5;
+			let second = import "testdata/./math.amoeba";
+			second["state"][0]
+			`,
+			5,
+		},
+		{`import "testdata/missing.amoeba"`, `could not import "testdata/missing.amoeba"`},
+		{`import "testdata/parse_error.amoeba"`, `could not parse "testdata/parse_error.amoeba": testdata/parse_error.amoeba:1:14`},
+		{`import "testdata/runtime_error.amoeba"`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(t, test.input)
+
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("errObj not of type *object.Error, got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if !strings.HasPrefix(errObj.Message, expected) {
+				t.Errorf("expected errObj.Message to start with %q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestImportBindingsOrder(t *testing.T) {
+	evaluated := testEval(t, `import "testdata/math.amoeba"`)
+
+	hash, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("hash not of type *object.Hash, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := []string{"square", "sumArray", "state"}
+	pairs := hash.Ordered()
+
+	if len(pairs) != len(expected) {
+		t.Fatalf("module has wrong number of bindings. got=%d, want=%d", len(pairs), len(expected))
+	}
+
+	for i, name := range expected {
+		testStringObject(t, pairs[i].Key, name)
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	evaluated := testEval(t, `import "testdata/cycle_a.amoeba"`)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("errObj not of type *object.Error, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	cycleA, _ := filepath.Abs("testdata/cycle_a.amoeba")
+	cycleB, _ := filepath.Abs("testdata/cycle_b.amoeba")
+	expected := "import cycle: " + cycleA + " -> " + cycleB + " -> " + cycleA
+
+	if errObj.Message != expected {
+		t.Errorf("expected errObj.Message to be %q, got=%q", expected, errObj.Message)
+	}
+
+	if errObj.Pos.Filename != "testdata/cycle_b.amoeba" {
+		t.Errorf("expected error to come from testdata/cycle_b.amoeba, got=%q", errObj.Pos.Filename)
+	}
+}
+
+func TestImportsShareModules(t *testing.T) {
+	update := `let m = import "testdata/math.amoeba"; m["state"][0] += 1; m["state"][0]`
+
+	// a file imported again within a run is the same module
+	testIntegerObject(t, testEval(t, update+"; "+update), 2)
+
+	// runs sharing modules only run each file once, any others start over
+	modules := NewModules()
+	testIntegerObject(t, evalWithOptions(update, Options{Modules: modules}), 1)
+	testIntegerObject(t, evalWithOptions(update, Options{Modules: modules}), 2)
+	testIntegerObject(t, evalWithOptions(update, Options{Modules: NewModules()}), 1)
+	testIntegerObject(t, testEval(t, update), 1)
+}
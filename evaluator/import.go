@@ -0,0 +1,103 @@
+package evaluator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+)
+
+// Modules keeps the files imported by the programs run with it, so
+// that each file is only run once however often it is imported. Both
+// ways of running a program import files through it
+type Modules struct {
+	// loaded has the bindings of every imported file by absolute path
+	loaded map[string]*object.Hash
+	// importing is the chain of files currently being imported,
+	// used to detect files that end up importing themselves
+	importing []string
+}
+
+// NewModules creates Modules with nothing imported yet
+func NewModules() *Modules {
+	return &Modules{loaded: map[string]*object.Hash{}}
+}
+
+// ModuleRunner runs the program of an imported file, returning the value
+// it ends with and a way to look up the globals it defined
+type ModuleRunner func(program *ast.Program) (object.Object, func(name string) (object.Object, bool))
+
+// Import returns a hash of the top-level let bindings of the file at
+// path, running it with run the first time it is imported. written is
+// the path as it appears in the import, for errors
+func (m *Modules) Import(path, written string, run ModuleRunner) object.Object {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return newError("could not import %q: %s", written, err)
+	}
+
+	for i, importing := range m.importing {
+		if importing == absPath {
+			cycle := append(append([]string{}, m.importing[i:]...), absPath)
+			return newError("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	if module, ok := m.loaded[absPath]; ok {
+		return module
+	}
+
+	data, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		return newError("could not import %q: %s", written, err)
+	}
+
+	p := parser.New(lexer.NewWithFilename(string(data), path))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("could not parse %q: %s", written, strings.Join(p.Errors(), ", "))
+	}
+
+	m.importing = append(m.importing, absPath)
+	result, get := run(program)
+	m.importing = m.importing[:len(m.importing)-1]
+
+	if isError(result) {
+		return result
+	}
+
+	module := object.NewHash()
+	for _, statement := range program.Statements {
+		if let, ok := statement.(*ast.LetStatement); ok {
+			if val, ok := get(let.Name.Value); ok {
+				module.Set(&object.String{Value: let.Name.Value}, val)
+			}
+		}
+	}
+
+	m.loaded[absPath] = module
+
+	return module
+}
+
+func (e *evaluation) evalImportExpression(node *ast.ImportExpression) object.Object {
+	path := resolveImportPath(node.Path, node.Token.Pos.Filename)
+
+	return e.opts.Modules.Import(path, node.Path, func(program *ast.Program) (object.Object, func(string) (object.Object, bool)) {
+		env := object.NewEnvironment()
+		return e.Eval(program, env), env.Get
+	})
+}
+
+// resolveImportPath makes relative import paths relative to the
+// directory of the file doing the importing, if there is one
+func resolveImportPath(path, importer string) string {
+	if filepath.IsAbs(path) || importer == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(importer), path)
+}
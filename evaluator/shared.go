@@ -0,0 +1,114 @@
+package evaluator
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+)
+
+// The functions below are the parts of evaluation that don't depend on the
+// ast, the vm package uses them so both ways of running a program behave
+// exactly the same
+
+// Prepare fills in the defaults of opts, and bounds ctx by its timeout
+// until cancel is called, before a program runs
+func Prepare(ctx context.Context, opts Options) (context.Context, Options, context.CancelFunc) {
+	if opts.Modules == nil {
+		opts.Modules = NewModules()
+	}
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+
+	if opts.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		return ctx, opts, cancel
+	}
+	return ctx, opts, func() {}
+}
+
+// StepLimitError is the error of a program taking more than max steps
+func StepLimitError(max int64) *object.Error {
+	return newLimitError(object.StepLimit, "step limit exceeded: more than %d steps", max)
+}
+
+// DepthLimitError is the error of a program nesting more than max calls
+func DepthLimitError(max int) *object.Error {
+	return newLimitError(object.DepthLimit, "call depth limit exceeded: more than %d nested calls", max)
+}
+
+// ContextError is the error of a program stopped by its context being done
+func ContextError(err error) *object.Error {
+	return newLimitError(object.ContextLimit, "evaluation stopped: %s", err)
+}
+
+// EvalPrefix applies a prefix operator to an evaluated operand, checked
+// is Options.CheckedArithmetic
+func EvalPrefix(operator string, right object.Object, checked bool) object.Object {
+	return evalPrefixExpression(operator, right, checked)
+}
+
+// EvalInfix applies an infix operator to evaluated operands, checked
+// is Options.CheckedArithmetic
+func EvalInfix(operator string, left, right object.Object, checked bool) object.Object {
+	return evalInfixExpression(operator, left, right, checked)
+}
+
+// EvalIndex indexes into an evaluated array or hash
+func EvalIndex(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// EvalIndexAssignment assigns val to an index of an evaluated array or hash
+func EvalIndexAssignment(left, index, val object.Object) object.Object {
+	return evalIndexAssignment(left, index, val)
+}
+
+// IsTruthy reports whether an object counts as true in a condition
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// NativeBool returns the TRUE or FALSE object for a bool
+func NativeBool(input bool) object.Object {
+	return nativeBoolToBooleanObject(input)
+}
+
+// Builtins returns every builtin function by name, with the ones that
+// write writing to out, for a run to look up the names it doesn't define
+func Builtins(out io.Writer) map[string]*object.Builtin {
+	return newBuiltins(out)
+}
+
+// builtinNames tells which names are builtins, the functions themselves
+// write nowhere
+var builtinNames = newBuiltins(ioutil.Discard)
+
+// IsBuiltin reports whether name is the name of a builtin function
+func IsBuiltin(name string) bool {
+	_, ok := builtinNames[name]
+	return ok
+}
+
+// BuiltinNames returns the names of every builtin function, sorted
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtinNames))
+	for name := range builtinNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveImportPath makes a relative import path relative to
+// the directory of the file doing the importing
+func ResolveImportPath(path, importer string) string {
+	return resolveImportPath(path, importer)
+}
@@ -0,0 +1,587 @@
+// Package format prints Amoeba programs in the one canonical style, so
+// that how code is laid out never has to be argued about
+package format
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+	"github.com/ASteinheiser/amoeba-interpreter/style"
+	"github.com/ASteinheiser/amoeba-interpreter/token"
+)
+
+// endOfFile is after every position in a program
+var endOfFile = token.Position{Line: math.MaxInt32}
+
+// Source parses a program and prints it in the canonical style, along
+// with its comments. A program that doesn't parse is returned as an
+// error listing why
+func Source(src, filename string) (string, error) {
+	l := lexer.NewWithFilename(src, filename)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	pr := &printer{lines: strings.Split(src, "\n"), comments: l.Comments()}
+
+	// the lexer skips a #! line, which has to stay the first line
+	// just like a comment would
+	if strings.HasPrefix(src, "#!") {
+		shebang := token.Comment{Text: pr.lines[0], Pos: token.Position{Line: 1, Column: 1}}
+		pr.comments = append([]token.Comment{shebang}, pr.comments...)
+	}
+
+	pr.statements(program.Statements, false, endOfFile)
+	if pr.out.Len() > 0 {
+		pr.print("\n")
+	}
+
+	return pr.out.String(), nil
+}
+
+// Node prints a single node in the canonical style. Without the source
+// it came from, there are no comments and statements are never
+// separated by blank lines
+func Node(node ast.Node) string {
+	pr := &printer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		pr.statements(node.Statements, false, endOfFile)
+	case ast.Statement:
+		pr.statement(node)
+	case ast.Expression:
+		pr.expression(node)
+	}
+
+	return pr.out.String()
+}
+
+// printer writes nodes to out, keeping track of how far in it is
+type printer struct {
+	out    bytes.Buffer
+	indent int
+	lines  []string // the source, for the blank lines between statements
+
+	comments []token.Comment // the ones still to be printed
+	lastLine int             // the source line of the last thing printed
+}
+
+func (p *printer) print(s string) { p.out.WriteString(s) }
+
+// newline starts a new line at the current indent
+func (p *printer) newline() {
+	p.print("\n")
+	p.print(strings.Repeat(style.Indent, p.indent))
+}
+
+// mark records that something from pos in the source has been printed
+func (p *printer) mark(pos token.Position) {
+	if pos.Line > p.lastLine {
+		p.lastLine = pos.Line
+	}
+}
+
+// separate starts the line for a statement or comment from line in the
+// source, after one that ended on prev. A single blank line is kept
+// where the source had one or more. The first line of a program starts
+// where it is, inside a block it starts on a new line
+func (p *printer) separate(prev, line int) {
+	if p.indent == 0 && p.out.Len() == 0 {
+		return
+	}
+
+	blank := line - 1
+	if prev > 0 && blank > prev && blank <= len(p.lines) && strings.TrimSpace(p.lines[blank-1]) == "" {
+		p.print("\n")
+	}
+	p.newline()
+}
+
+// before reports whether position a comes before b
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// leadingComments prints the comments that come before pos on lines of
+// their own, returning the line the last one ends on, or prev if none
+func (p *printer) leadingComments(prev int, pos token.Position) int {
+	for len(p.comments) > 0 && before(p.comments[0].Pos, pos) {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+
+		p.separate(prev, comment.Pos.Line)
+		p.print(strings.TrimRight(comment.Text, " \t"))
+		prev = comment.Pos.Line + strings.Count(comment.Text, "\n")
+		p.lastLine = prev
+	}
+	return prev
+}
+
+// trailingComments prints the comments that come before pos and on the
+// line of the last thing printed, after it on the same line
+func (p *printer) trailingComments(pos token.Position) {
+	for len(p.comments) > 0 && before(p.comments[0].Pos, pos) && p.comments[0].Pos.Line == p.lastLine {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+
+		p.print(" " + strings.TrimRight(comment.Text, " \t"))
+		p.lastLine = comment.Pos.Line + strings.Count(comment.Text, "\n")
+	}
+}
+
+// statements prints statements and the comments between them on lines
+// of their own, along with the comments after them up to end. When the
+// statements are the body of a function or an if, the last one is their
+// value and goes without a semicolon
+func (p *printer) statements(stmts []ast.Statement, value bool, end token.Position) {
+	prev := 0
+	for i, stmt := range stmts {
+		prev = p.leadingComments(prev, stmt.Pos())
+		p.separate(prev, stmt.Pos().Line)
+		prev = stmt.Pos().Line
+
+		next := end
+		if i < len(stmts)-1 {
+			next = stmts[i+1].Pos()
+		}
+
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && value && i == len(stmts)-1 {
+			p.expression(es.Expression)
+		} else {
+			p.statement(stmt)
+		}
+
+		// an if carries on into a next statement that starts like an operator
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && i < len(stmts)-1 {
+			if _, isIf := es.Expression.(*ast.IfExpression); isIf && carriesOn(stmts[i+1]) {
+				p.print(";")
+			}
+		}
+
+		p.trailingComments(next)
+	}
+
+	p.leadingComments(prev, end)
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	p.mark(stmt.Pos())
+
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.print("let " + stmt.Name.Value + " = ")
+		p.expression(stmt.Value)
+		p.print(";")
+
+	case *ast.ReturnStatement:
+		p.print("return")
+		if stmt.ReturnValue != nil {
+			p.print(" ")
+			p.expression(stmt.ReturnValue)
+		}
+		p.print(";")
+
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+		// like loops, an if ends with its block and needs no semicolon
+		if _, ok := stmt.Expression.(*ast.IfExpression); !ok {
+			p.print(";")
+		}
+
+	case *ast.WhileStatement:
+		p.print("while (")
+		p.expression(stmt.Condition)
+		p.print(") ")
+		p.block(stmt.Body, false)
+
+	case *ast.ForStatement:
+		p.print("for (")
+		p.clause(stmt.Init)
+		p.print(";")
+		if stmt.Condition != nil {
+			p.print(" ")
+			p.expression(stmt.Condition)
+		}
+		p.print(";")
+		if stmt.Update != nil {
+			p.print(" ")
+			p.clause(stmt.Update)
+		}
+		p.print(") ")
+		p.block(stmt.Body, false)
+
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		p.print(stmt.TokenLiteral() + ";")
+
+	case *ast.BlockStatement:
+		p.block(stmt, false)
+	}
+}
+
+// clause prints the init or update statement of a for loop,
+// which the loop itself separates with semicolons
+func (p *printer) clause(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case nil:
+	case *ast.LetStatement:
+		p.print("let " + stmt.Name.Value + " = ")
+		p.expression(stmt.Value)
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+	default:
+		p.statement(stmt)
+	}
+}
+
+// block prints braces around statements indented one level further,
+// or just the braces when there is nothing inside them
+func (p *printer) block(block *ast.BlockStatement, value bool) {
+	if len(block.Statements) == 0 && (len(p.comments) == 0 || !before(p.comments[0].Pos, block.End)) {
+		p.print("{}")
+		p.mark(block.End)
+		return
+	}
+
+	first := block.End
+	if len(block.Statements) > 0 {
+		first = block.Statements[0].Pos()
+	}
+
+	p.print("{")
+	p.mark(block.Pos())
+	p.trailingComments(first)
+
+	p.indent++
+	p.statements(block.Statements, value, block.End)
+	p.indent--
+	p.newline()
+	p.print("}")
+	p.mark(block.End)
+}
+
+func (p *printer) expression(exp ast.Expression) {
+	p.mark(exp.Pos())
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.print(exp.Value)
+
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.BooleanLiteral:
+		p.print(exp.TokenLiteral())
+
+	case *ast.StringLiteral:
+		if exp.Token.Type == token.RAW_STRING {
+			p.print("`" + exp.Value + "`")
+		} else {
+			p.print(style.Quote(exp.Value))
+		}
+
+	case *ast.TemplateLiteral:
+		p.template(exp)
+
+	case *ast.PrefixExpression:
+		p.print(exp.Operator)
+		// two minuses in a row would read as a decrement
+		p.operand(exp.Right, precedence(exp.Right) < parser.PREFIX || exp.Operator == "-" && startsWithMinus(exp.Right))
+
+	case *ast.UpdateExpression:
+		if exp.Prefix {
+			p.print(exp.Operator)
+			p.operand(exp.Target, precedence(exp.Target) < parser.PREFIX)
+		} else {
+			p.operand(exp.Target, precedence(exp.Target) < parser.POSTFIX)
+			p.print(exp.Operator)
+		}
+
+	case *ast.InfixExpression:
+		// operators group to the left, so only the right operand
+		// needs parentheses for the same precedence
+		prec := precedence(exp)
+		p.operand(exp.Left, precedence(exp.Left) < prec)
+		p.print(" " + exp.Operator + " ")
+		p.operand(exp.Right, precedence(exp.Right) <= prec)
+
+	case *ast.AssignExpression:
+		// assignments group to the right, a = b = c
+		p.operand(exp.Target, precedence(exp.Target) <= parser.ASSIGN)
+		p.print(" " + exp.Operator + " ")
+		p.operand(exp.Value, precedence(exp.Value) < parser.ASSIGN)
+
+	case *ast.IfExpression:
+		p.print("if (")
+		p.expression(exp.Condition)
+		p.print(") ")
+		p.block(exp.Consequence, true)
+		if exp.Alternative != nil {
+			p.print(" else ")
+			p.block(exp.Alternative, true)
+		}
+
+	case *ast.FunctionLiteral:
+		params := make([]string, len(exp.Parameters))
+		for i, param := range exp.Parameters {
+			params[i] = param.Value
+		}
+		p.print("fn(" + strings.Join(params, ", ") + ") ")
+		p.block(exp.Body, true)
+
+	case *ast.CallExpression:
+		args := p.expressions(exp.Arguments)
+		broken := p.breaks(exp, exp.Token.Pos, args, exp.End)
+		p.operand(exp.Function, precedence(exp.Function) < parser.CALL)
+		p.list("(", args, ")", exp.End, broken)
+
+	case *ast.IndexExpression:
+		p.operand(exp.Left, precedence(exp.Left) < parser.CALL)
+		p.print("[")
+		p.expression(exp.Index)
+		p.print("]")
+
+	case *ast.ArrayLiteral:
+		elements := p.expressions(exp.Elements)
+		p.list("[", elements, "]", exp.End, p.breaks(exp, exp.Token.Pos, elements, exp.End))
+
+	case *ast.HashLiteral:
+		pairs := make([]item, len(exp.Pairs))
+		for i, pair := range exp.Pairs {
+			pair := pair
+			pairs[i] = item{pos: start(pair.Key), print: func() {
+				p.expression(pair.Key)
+				p.print(": ")
+				p.expression(pair.Value)
+			}}
+		}
+		p.list("{", pairs, "}", exp.End, p.breaks(exp, exp.Token.Pos, pairs, exp.End))
+
+	case *ast.ImportExpression:
+		p.print("import " + style.Quote(exp.Path))
+	}
+}
+
+// operand prints an expression that is part of another one,
+// in parentheses when it would otherwise be parsed differently
+func (p *printer) operand(exp ast.Expression, parens bool) {
+	if parens {
+		p.print("(")
+	}
+	p.expression(exp)
+	if parens {
+		p.print(")")
+	}
+}
+
+// item is an element of a list, which print prints
+type item struct {
+	pos   token.Position
+	print func()
+}
+
+// expressions makes the items of a list of expressions
+func (p *printer) expressions(exps []ast.Expression) []item {
+	items := make([]item, len(exps))
+	for i, exp := range exps {
+		exp := exp
+		items[i] = item{pos: start(exp), print: func() { p.expression(exp) }}
+	}
+	return items
+}
+
+// breaks reports whether the list of exp, from open to end, is printed
+// one item per line. It is when there are comments in it, which have
+// to stay next to their items, or when the source had it on several
+// lines and it doesn't fit on one
+func (p *printer) breaks(exp ast.Expression, open token.Position, items []item, end token.Position) bool {
+	for _, comment := range p.comments {
+		if !before(comment.Pos, end) {
+			break
+		}
+		if before(open, comment.Pos) {
+			return true
+		}
+	}
+
+	// a list is only broken in the source when an item or the end
+	// doesn't start on the line it opens on, a function as the last
+	// argument still has the call stay on one line
+	broken := len(items) > 0 && items[len(items)-1].pos.Line > open.Line ||
+		len(items) == 0 && end.Line > open.Line
+	if p.lines == nil || !broken {
+		return false
+	}
+
+	flat := Node(exp)
+	return strings.Contains(flat, "\n") || p.column()+utf8.RuneCountInString(flat) > style.Width
+}
+
+// column returns how many characters into its line the printer is
+func (p *printer) column() int {
+	out := p.out.Bytes()
+	return utf8.RuneCount(out[bytes.LastIndexByte(out, '\n')+1:])
+}
+
+// list prints items separated by commas between open and close, either
+// on one line or broken up with each item and its comments on their own
+func (p *printer) list(open string, items []item, close string, end token.Position, broken bool) {
+	p.print(open)
+
+	if !broken {
+		for i, it := range items {
+			if i > 0 {
+				p.print(", ")
+			}
+			it.print()
+		}
+		p.print(close)
+		p.mark(end)
+		return
+	}
+
+	first := end
+	if len(items) > 0 {
+		first = items[0].pos
+	}
+	p.trailingComments(first)
+
+	p.indent++
+	prev := p.lastLine
+	for i, it := range items {
+		prev = p.leadingComments(prev, it.pos)
+		p.separate(prev, it.pos.Line)
+		it.print()
+
+		next := end
+		if i < len(items)-1 {
+			p.print(",")
+			next = items[i+1].pos
+		}
+		p.trailingComments(next)
+		prev = p.lastLine
+	}
+	p.leadingComments(prev, end)
+	p.indent--
+
+	p.newline()
+	p.print(close)
+	p.mark(end)
+}
+
+// precedence returns how tightly an expression holds together, the same
+// as the parser sees it. Anything that starts with its own keyword or
+// bracket holds together more tightly than any operator
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(exp.Token.Type)
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.UpdateExpression:
+		if exp.Prefix {
+			return parser.PREFIX
+		}
+		return parser.POSTFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	default:
+		return parser.INDEX + 1
+	}
+}
+
+// carriesOn reports whether stmt is printed starting with a (, [ or -,
+// which would carry on an if printed right before it
+func carriesOn(stmt ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	return ok && startsLikeOperator(es.Expression)
+}
+
+// startsLikeOperator reports whether exp is printed starting with a (, [
+// or -, going by its leftmost operand instead of printing all of it
+func startsLikeOperator(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		return exp.Operator == "-"
+	case *ast.UpdateExpression:
+		if exp.Prefix {
+			return exp.Operator == "--"
+		}
+		return precedence(exp.Target) < parser.POSTFIX || startsLikeOperator(exp.Target)
+	case *ast.InfixExpression:
+		return precedence(exp.Left) < precedence(exp) || startsLikeOperator(exp.Left)
+	case *ast.AssignExpression:
+		return precedence(exp.Target) <= parser.ASSIGN || startsLikeOperator(exp.Target)
+	case *ast.CallExpression:
+		return precedence(exp.Function) < parser.CALL || startsLikeOperator(exp.Function)
+	case *ast.IndexExpression:
+		return precedence(exp.Left) < parser.CALL || startsLikeOperator(exp.Left)
+	case *ast.ArrayLiteral:
+		return true
+	default:
+		return false
+	}
+}
+
+// start returns where exp starts in the source, which for operators
+// and calls is at their leftmost operand rather than their token
+func start(exp ast.Expression) token.Position {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return start(exp.Left)
+	case *ast.AssignExpression:
+		return start(exp.Target)
+	case *ast.CallExpression:
+		return start(exp.Function)
+	case *ast.IndexExpression:
+		return start(exp.Left)
+	case *ast.UpdateExpression:
+		if !exp.Prefix {
+			return start(exp.Target)
+		}
+	}
+	return exp.Pos()
+}
+
+// startsWithMinus reports whether exp is printed starting with a minus
+func startsWithMinus(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		return exp.Operator == "-"
+	case *ast.UpdateExpression:
+		return exp.Prefix && exp.Operator == "--"
+	default:
+		return false
+	}
+}
+
+// template writes tl as a string literal with its expressions
+// interpolated into it
+func (p *printer) template(tl *ast.TemplateLiteral) {
+	var out strings.Builder
+	out.WriteByte('"')
+
+	for i, exp := range tl.Expressions {
+		style.Escape(&out, tl.Strings[i])
+		out.WriteString("${")
+		p.print(out.String())
+		out.Reset()
+
+		p.expression(exp)
+		out.WriteByte('}')
+	}
+
+	style.Escape(&out, tl.Strings[len(tl.Strings)-1])
+	out.WriteByte('"')
+	p.print(out.String())
+}
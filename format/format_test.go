@@ -0,0 +1,285 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1", "let x = 1;\n"},
+		{"", ""},
+		{"let  add = fn(a,b){a+b}", "let add = fn(a, b) {\n  a + b\n};\n"},
+		{"fn() {}", "fn() {};\n"},
+		{
+			"if(x>1){print(x);x}else{0}",
+			"if (x > 1) {\n  print(x);\n  x\n} else {\n  0\n}\n",
+		},
+		{
+			"while (i < 3) { i += 1 } for (let i = 0; i < 3; i += 1) { if (i == 1) { continue } break }",
+			"while (i < 3) {\n  i += 1;\n}\nfor (let i = 0; i < 3; i += 1) {\n  if (i == 1) {\n    continue;\n  }\n  break;\n}\n",
+		},
+		{"for (;;) { break; }", "for (;;) {\n  break;\n}\n"},
+		{"for (; i < 3;) {}", "for (; i < 3;) {}\n"},
+		{"return add(1, 2);", "return add(1, 2);\n"},
+		{`let h = {"a":1,2:[1,2]}; h["a"]`, "let h = {\"a\": 1, 2: [1, 2]};\nh[\"a\"];\n"},
+		{`let m = import "math.amoeba"`, "let m = import \"math.amoeba\";\n"},
+		{"let x = 1;\n\n\n\nlet y = 2;\nlet z = 3;", "let x = 1;\n\nlet y = 2;\nlet z = 3;\n"},
+		{
+			"let f = fn() {\n  let x = 1;\n\n  x\n};",
+			"let f = fn() {\n  let x = 1;\n\n  x\n};\n",
+		},
+		{"#!/usr/bin/env amoeba\n\nprint(1)", "#!/usr/bin/env amoeba\n\nprint(1);\n"},
+		{"#!/usr/bin/env amoeba\nprint(1)", "#!/usr/bin/env amoeba\nprint(1);\n"},
+		{"if (x) { 1 };\n-1", "if (x) {\n  1\n};\n-1;\n"},
+		{"if (x) { 1 }\nlet y = 1", "if (x) {\n  1\n}\nlet y = 1;\n"},
+		{`let s = "a\tb \"c\" \\ \u{e9}\u{1F600}\u{7}\u{0}"`, "let s = \"a\\tb \\\"c\\\" \\\\ é😀\\u{7}\\0\";\n"},
+		{"let s = \"two\nlines\"", "let s = \"two\\nlines\";\n"},
+		{"let s = `raw \\n\n  kept`", "let s = `raw \\n\n  kept`;\n"},
+		{`"sum:\t${ a+b }, ${ {"k":1}["k"] }"`, "\"sum:\\t${a + b}, ${{\"k\": 1}[\"k\"]}\";\n"},
+		{`"\${x} $x ${"in${y}"}"`, "\"\\${x} $x ${\"in${y}\"}\";\n"},
+	}
+
+	for _, test := range tests {
+		output, err := Source(test.input, "")
+		if err != nil {
+			t.Errorf("%q failed to format: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%q formatted wrong. expected=%q, got=%q", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// only a comment", "// only a comment\n"},
+		{"let x = 1; // one   ", "let x = 1; // one\n"},
+		{
+			"// header\n\n// about x\nlet x=1\n/* block\n   comment */\nlet y=2",
+			"// header\n\n// about x\nlet x = 1;\n/* block\n   comment */\nlet y = 2;\n",
+		},
+		{
+			"let f = fn(x) { // why\n// first\nlet y = x;\n\n  // last\ny\n// trailing\n}",
+			"let f = fn(x) { // why\n  // first\n  let y = x;\n\n  // last\n  y\n  // trailing\n};\n",
+		},
+		{"while (x) { /* nothing yet */ }", "while (x) { /* nothing yet */\n}\n"},
+		{"if (x) {\n  // todo\n}", "if (x) {\n  // todo\n}\n"},
+		{"let x = [1, // one\n2];\nx", "let x = [\n  1, // one\n  2\n];\nx;\n"},
+		{"#!/usr/bin/env amoeba\n// script\nx", "#!/usr/bin/env amoeba\n// script\nx;\n"},
+		{"x /* end */", "x; /* end */\n"},
+	}
+
+	for _, test := range tests {
+		output, err := Source(test.input, "")
+		if err != nil {
+			t.Errorf("%q failed to format: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%q formatted wrong. expected=%q, got=%q", test.input, test.expected, output)
+		}
+
+		if again, _ := Source(output, ""); again != output {
+			t.Errorf("%q changed when formatted again. got=%q", test.input, again)
+		}
+	}
+}
+
+func TestSourceLists(t *testing.T) {
+	long := `"aaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbb", "cccccccccccccccccccc", "dddddddddddd"`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// comments stay next to the element they are on the line of or before
+		{
+			"let config = {\n\"name\": \"amoeba\", // the language\n// how deep calls go\n\"depth\": 10000\n};",
+			"let config = {\n  \"name\": \"amoeba\", // the language\n  // how deep calls go\n  \"depth\": 10000\n};\n",
+		},
+		{"let a = [ // first\n1, 2]", "let a = [ // first\n  1,\n  2\n];\n"},
+		{"let a = [1,\n2 // last\n]", "let a = [\n  1,\n  2 // last\n];\n"},
+		{"let e = [\n// nothing yet\n]", "let e = [\n  // nothing yet\n];\n"},
+		{"f(1, // one\n2)", "f(\n  1, // one\n  2\n);\n"},
+		{"[[1, // one\n2], 3]", "[\n  [\n    1, // one\n    2\n  ],\n  3\n];\n"},
+		{"let h = {\n\"a\": 1,\n\n\"b\": [1, // one\n2]\n}", "let h = {\n  \"a\": 1,\n\n  \"b\": [\n    1, // one\n    2\n  ]\n};\n"},
+		// without comments, broken lists are only kept when they don't fit
+		{"let h = {\n\"a\": 1,\n\"b\": 2\n}", "let h = {\"a\": 1, \"b\": 2};\n"},
+		{"let a = [\n" + long + "\n]", "let a = [\n  " + strings.Replace(long, ", ", ",\n  ", -1) + "\n];\n"},
+		{"let a = [" + long + "]", "let a = [" + long + "];\n"},
+		{"map(a, fn(x) {\nx\n})", "map(a, fn(x) {\n  x\n});\n"},
+		{"[\nfn() { 1 },\n2\n]", "[\n  fn() {\n    1\n  },\n  2\n];\n"},
+	}
+
+	for _, test := range tests {
+		output, err := Source(test.input, "")
+		if err != nil {
+			t.Errorf("%q failed to format: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%q formatted wrong. expected=\n%s\ngot=\n%s", test.input, test.expected, output)
+		}
+
+		if again, _ := Source(output, ""); again != output {
+			t.Errorf("%q changed when formatted again. got=\n%s", test.input, again)
+		}
+	}
+}
+
+func TestSourceParentheses(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+		{"1 + (2 * 3)", "1 + 2 * 3;\n"},
+		{"(1 - 2) - 3", "1 - 2 - 3;\n"},
+		{"1 - (2 - 3)", "1 - (2 - 3);\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"-(-a)", "-(-a);\n"},
+		{"!(!a)", "!!a;\n"},
+		{"-a * b", "-a * b;\n"},
+		{"-a[0]", "-a[0];\n"},
+		{"(a == b) == c", "a == b == c;\n"},
+		{"a + (b = 1)", "a + (b = 1);\n"},
+		{"a = b = c", "a = b = c;\n"},
+		{"a[0] += (1 + 2)", "a[0] += 1 + 2;\n"},
+		{"(fn(x) { x })(1)", "fn(x) {\n  x\n}(1);\n"},
+		{"f(1)(2)[3]", "f(1)(2)[3];\n"},
+		{"(a + b)[0]", "(a + b)[0];\n"},
+		{"(-a)(1)", "(-a)(1);\n"},
+		{"(a || b) && c", "(a || b) && c;\n"},
+		{"a || (b && c)", "a || b && c;\n"},
+		{"(a && b) && c", "a && b && c;\n"},
+		{"(a <= b) == (c % 2 >= d)", "a <= b == c % 2 >= d;\n"},
+		{"x %= (1 % 2)", "x %= 1 % 2;\n"},
+		{"(x)++ + ++(y)", "x++ + ++y;\n"},
+		{"-(--x)", "-(--x);\n"},
+		{"-(x--)", "-x--;\n"},
+		{"a - (--b)", "a - --b;\n"},
+		{"(a[0])++", "a[0]++;\n"},
+	}
+
+	for _, test := range tests {
+		output, err := Source(test.input, "")
+		if err != nil {
+			t.Errorf("%q failed to format: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%q formatted wrong. expected=%q, got=%q", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := Source("let x = ;", "bad.amoeba")
+
+	expected := "bad.amoeba:1:9: no prefix parsing fn for ; found"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%v", expected, err)
+	}
+}
+
+// formatting has to keep what a program means, and formatting
+// something already formatted must not change it again
+func TestSourceRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let x = 5 * (2 + 10) / -3 - !true",
+		"let a = [1, 2 * 2, fn(x) { x }(3)][1 + 1]",
+		"let h = {\"one\": 1, true: fn() { if (x < y) { x } else { y } }}",
+		"let counter = fn() { let n = 0; fn() { n += 1; n } }; counter()()",
+		"let f = fn(x) { if (x > 1) { return x * f(x - 1) } 1 }",
+		"a = b = c[0] = 1 + 2 * 3 - (4 - 5)",
+		"for (let i = 0; i < 10; i = i + 1) { while (true) { break } if (i == 2) { continue } }",
+		"if (a) { 1 }; (b)",
+		"if (a) { 1 }; [1, 2]",
+		"-(-(-1)) - -1",
+		"let i = 0; while (i < 3) { a[i++]--; -(--i) }\n--i",
+		`let s = "a ${fn(x) { x }(1)} \\${b} ${"c${d}"}$"`,
+	}
+
+	for _, input := range inputs {
+		once, err := Source(input, "")
+		if err != nil {
+			t.Errorf("%q failed to format: %s", input, err)
+			continue
+		}
+
+		twice, err := Source(once, "")
+		if err != nil {
+			t.Errorf("%q formatted into a program that doesn't parse: %s\n%s", input, err, once)
+			continue
+		}
+		if once != twice {
+			t.Errorf("%q changed when formatted again.\nonce:\n%s\ntwice:\n%s", input, once, twice)
+		}
+
+		before := parser.New(lexer.New(input)).ParseProgram().String()
+		after := parser.New(lexer.New(once)).ParseProgram().String()
+		if before != after {
+			t.Errorf("%q changed meaning. before=%q, after=%q", input, before, after)
+		}
+	}
+}
+
+func TestNode(t *testing.T) {
+	program := parser.New(lexer.New("let f = fn(x) {\n\n  x + 1 }")).ParseProgram()
+
+	expected := "let f = fn(x) {\n  x + 1\n};"
+	if output := Node(program); output != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, output)
+	}
+
+	fn := program.Statements[0]
+	if output := Node(fn); output != expected {
+		t.Errorf("wrong statement output. expected=%q, got=%q", expected, output)
+	}
+}
+
+// whether a statement carries on an if before it is decided from its
+// leftmost operand, which has to agree with how it is printed
+func TestStartsLikeOperator(t *testing.T) {
+	inputs := []string{
+		"x", "-x", "!x", "--x", "++x", "x--", "(a[0])--", "a[-1]--",
+		"-1 + 2", "(a = b) + 1", "a = b", "a = b = c", "[1][0]", "(-f)(1)",
+		"f(x)[0]", "-f(x)", "[1, 2]", "{}", `"s"`, "fn() { 1 }()", "(fn() { 1 })()",
+		"(if (a) { 1 })[0]", "a[0]++", "-a * b", "(a || b) && c",
+	}
+
+	for _, input := range inputs {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		stmt := program.Statements[0]
+
+		printed := Node(stmt)
+		expected := strings.IndexByte("([-", printed[0]) >= 0
+		if carriesOn(stmt) != expected {
+			t.Errorf("carriesOn(%q) wrong for %q. expected=%t", input, printed, expected)
+		}
+	}
+}
+
+// deciding where an if ends must not print what comes after it again,
+// which took time exponential in how deeply statements are nested
+func TestSourceDeepNesting(t *testing.T) {
+	src := "1"
+	for i := 0; i < 40; i++ {
+		src = "1; f(fn() { " + src + " })"
+	}
+
+	if _, err := Source(src, ""); err != nil {
+		t.Fatalf("failed to format: %s", err)
+	}
+}
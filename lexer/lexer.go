@@ -1,25 +1,62 @@
 package lexer
 
-import "github.com/ASteinheiser/amoeba-interpreter/token"
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ASteinheiser/amoeba-interpreter/token"
+)
 
 // Lexer is fed the program to be interpreted
 // and reads over the characters one at a time
 // returning tokens for each character
 type Lexer struct {
 	input    string
+	filename string
 	position int  // current character position
 	readPos  int  // reading position, ahead of current char
 	ch       byte // current character value
+	line     int  // line of the current character
+	column   int  // column of the current character
+
+	comments []token.Comment
+
+	// interpolations holds how many braces are open inside each ${ of a
+	// string that hasn't been closed, innermost last, so the } that ends
+	// one can carry on with the rest of the string
+	interpolations []int
+
+	// pending is a token that is ready to be returned next
+	pending *token.Token
 }
 
 // New will create a Lexer to turn source code into tokens
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFilename(input, "")
+}
+
+// NewWithFilename will create a Lexer that records the given
+// file name in the position of every token it returns
+func NewWithFilename(input, filename string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
+
+	// a #! line at the very start lets scripts be run directly, like
+	// #!/usr/bin/env amoeba, so it is skipped up to the newline
+	if strings.HasPrefix(input, "#!") {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	}
+
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
 	if l.readPos >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -27,13 +64,41 @@ func (l *Lexer) readChar() {
 	}
 	l.position = l.readPos
 	l.readPos++
+	l.column++
+}
+
+func (l *Lexer) currentPos() token.Position {
+	return token.Position{Filename: l.filename, Line: l.line, Column: l.column}
 }
 
+// Comments returns the comments skipped over so far, in source order
+func (l *Lexer) Comments() []token.Comment { return l.comments }
+
 // NextToken will return the next token in the input
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace()
+	if l.pending != nil {
+		tok, l.pending = *l.pending, nil
+		return tok
+	}
+
+	for {
+		l.skipWhitespace()
+		if l.ch != '/' || l.peekChar() != '/' && l.peekChar() != '*' {
+			break
+		}
+
+		comment := token.Comment{Pos: l.currentPos()}
+		var ok bool
+		comment.Text, ok = l.readComment()
+		if !ok {
+			return token.Token{Type: token.UNTERMINATED_COMMENT, Literal: comment.Text, Pos: comment.Pos}
+		}
+		l.comments = append(l.comments, comment)
+	}
+
+	pos := l.currentPos()
 
 	switch l.ch {
 	case '=':
@@ -50,13 +115,37 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.PLUS_ASSIGN
+		} else if l.peekChar() == '+' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.INCREMENT
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readString(pos, token.STRING, token.TEMPLATE_HEAD)
+		l.readChar()
+		return tok
+	case '`':
+		tok.Literal, tok.Type = l.readRawString()
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1] == 0 {
+			l.interpolations = l.interpolations[:n-1]
+			tok = l.readString(pos, token.TEMPLATE_TAIL, token.TEMPLATE_MIDDLE)
+			l.readChar()
+			return tok
+		}
+		if n > 0 {
+			l.interpolations[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
@@ -74,15 +163,64 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.MINUS_ASSIGN
+		} else if l.peekChar() == '-' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.DECREMENT
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.SLASH_ASSIGN
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.ASTERISK_ASSIGN
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		if l.peekChar() == '=' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.PERCENT_ASSIGN
+		} else {
+			tok = newToken(token.PERCENT, l.ch)
+		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.LT_EQ
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.GT_EQ
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.AND
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok.Literal = l.makeTwoCharLiteral()
+			tok.Type = token.OR
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -90,10 +228,11 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -101,6 +240,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
@@ -126,23 +266,187 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
+// readComment reads a comment, up to the end of the line for // and up
+// to the closing */ for /*, which a comment running into the end of the
+// input is missing
+func (l *Lexer) readComment() (string, bool) {
+	position := l.position
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return strings.TrimRight(l.input[position:l.position], "\r"), true
+	}
+
+	l.readChar()
+	l.readChar()
+	for !(l.ch == '*' && l.peekChar() == '/') {
+		if l.ch == 0 {
+			return l.input[position:l.position], false
+		}
+		l.readChar()
+	}
+	l.readChar()
+	l.readChar()
+
+	return l.input[position:l.position], true
+}
+
+// readString reads a string up to its closing quote, turning escape
+// sequences into the characters they stand for. A string that runs into
+// the end of the input is missing its closing quote.
+//
+// Reading stops early at a ${, returning the text so far as the
+// interpolated type, and the } that closes the interpolation carries on
+// reading the rest of the string. Otherwise the text is the ended type.
+//
+// An escape sequence that doesn't exist is returned first, at its
+// backslash, with the string waiting to be returned after it
+func (l *Lexer) readString(pos token.Position, ended, interpolated token.Type) token.Token {
+	var value strings.Builder
+	var invalid *token.Token
+
+	finish := func(tokenType token.Type) token.Token {
+		tok := token.Token{Type: tokenType, Literal: value.String(), Pos: pos}
+		if invalid == nil {
+			return tok
+		}
+		l.pending = &tok
+		return *invalid
+	}
+
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+
+		switch l.ch {
+		case 0:
+			return token.Token{Type: token.UNTERMINATED_STRING, Literal: value.String(), Pos: pos}
+		case '"':
+			return finish(ended)
+		case '$':
+			if l.peekChar() != '{' {
+				value.WriteByte(l.ch)
+				continue
+			}
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+			return finish(interpolated)
+		case '\\':
+			escapePos, start := l.currentPos(), l.position
+			if !l.readEscape(&value) && invalid == nil {
+				invalid = &token.Token{Type: token.INVALID_ESCAPE, Literal: l.input[start : l.position+1], Pos: escapePos}
+			}
+		default:
+			value.WriteByte(l.ch)
 		}
 	}
-	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// escapes are the characters that stand for another after a backslash
+var escapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'"':  '"',
+	'$':  '$',
+	'\\': '\\',
+}
+
+// readEscape reads the escape sequence after a backslash, writing the
+// character it stands for to value, and reports whether it exists.
+// \u{1F600} stands for the Unicode code point written in hex. It only
+// reads as far as the sequence goes, leaving anything else for the string
+func (l *Lexer) readEscape(value *strings.Builder) bool {
+	if l.peekChar() == 0 {
+		return false
+	}
+	l.readChar()
+
+	if ch, ok := escapes[l.ch]; ok {
+		value.WriteByte(ch)
+		return true
+	}
+	if l.ch != 'u' || l.peekChar() != '{' {
+		return false
+	}
+	l.readChar()
+
+	var r rune
+	digits := 0
+	for isHexDigit(l.peekChar()) && digits < 6 {
+		l.readChar()
+		r = r*16 + hexValue(l.ch)
+		digits++
+	}
+	if l.peekChar() != '}' || digits == 0 {
+		return false
+	}
+	l.readChar()
+
+	if !utf8.ValidRune(r) {
+		return false
+	}
+	value.WriteRune(r)
+	return true
+}
+
+// readRawString reads a string between backticks, which has no escape
+// sequences and can span lines. Carriage returns are left out, so the
+// string is the same whatever line endings the file was saved with
+func (l *Lexer) readRawString() (string, token.Type) {
+	var value strings.Builder
+
+	for {
+		l.readChar()
+
+		switch l.ch {
+		case 0:
+			return value.String(), token.UNTERMINATED_STRING
+		case '`':
+			return value.String(), token.RAW_STRING
+		case '\r':
+		default:
+			value.WriteByte(l.ch)
+		}
+	}
+}
+
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func hexValue(ch byte) rune {
+	switch {
+	case isDigit(ch):
+		return rune(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return rune(ch-'a') + 10
+	default:
+		return rune(ch-'A') + 10
+	}
+}
+
+// readNumber reads an integer, or a float when the digits
+// are followed by a decimal point and more digits
+func (l *Lexer) readNumber() (string, token.Type) {
 	position := l.position
+	tokenType := token.Type(token.INT)
+
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	return l.input[position:l.position], tokenType
 }
 
 func isDigit(ch byte) bool {
@@ -150,7 +454,7 @@ func isDigit(ch byte) bool {
 }
 
 func (l *Lexer) peekChar() byte {
-	if l.readPos > len(l.input) {
+	if l.readPos >= len(l.input) {
 		return 0
 	}
 	return l.input[l.readPos]
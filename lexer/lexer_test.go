@@ -17,7 +17,7 @@ func TestNextToken(t *testing.T) {
 
 		let result = add(four, seventeen);
 
-		!-/*5;
+		!-/ *5;
 		5 < 10 > 5;
 
 		if (5 < 10) {
@@ -35,6 +35,16 @@ func TestNextToken(t *testing.T) {
 		[1, 2, 3];
 
 		{ "key": "value" }
+
+		while for break continue import
+
+		x = 1; x += 2; x -= 3; x *= 4; x /= 5;
+
+		3.14 0.5;
+
+		a <= b >= c % d && e || f; x %= 2; & |
+
+		x++; --x;
 	`
 
 	tests := []struct {
@@ -129,6 +139,58 @@ func TestNextToken(t *testing.T) {
 		{token.COLON, ":"},
 		{token.STRING, "value"},
 		{token.RBRACE, "}"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.IMPORT, "import"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "d"},
+		{token.AND, "&&"},
+		{token.IDENT, "e"},
+		{token.OR, "||"},
+		{token.IDENT, "f"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.IDENT, "x"},
+		{token.INCREMENT, "++"},
+		{token.SEMICOLON, ";"},
+		{token.DECREMENT, "--"},
+		{token.IDENT, "x"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -148,3 +210,264 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 4;\n  x + \"str\";\n"
+
+	tests := []struct {
+		expectedType   token.Type
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.PLUS, 2, 5},
+		{token.STRING, 2, 7},
+		{token.SEMICOLON, 2, 12},
+		{token.EOF, 3, 1},
+	}
+
+	l := NewWithFilename(input, "test.amoeba")
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.expectedType {
+			t.Fatalf("test [%d] - tokentype wrong. expected=%q, got=%q",
+				i, test.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Line != test.expectedLine || tok.Pos.Column != test.expectedColumn {
+			t.Fatalf("test [%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, test.expectedLine, test.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+
+		if tok.Pos.Filename != "test.amoeba" {
+			t.Fatalf("test [%d] - filename wrong. expected=%q, got=%q",
+				i, "test.amoeba", tok.Pos.Filename)
+		}
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	l := New("let s = \"abc\ndef")
+
+	for _, expected := range []token.Type{token.LET, token.IDENT, token.ASSIGN} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("tokentype wrong. expected=%q, got=%q", expected, tok.Type)
+		}
+	}
+
+	tok := l.NextToken()
+	if tok.Type != token.UNTERMINATED_STRING {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.UNTERMINATED_STRING, tok.Type)
+	}
+	if tok.Literal != "abc\ndef" {
+		t.Fatalf("literal wrong. expected=%q, got=%q", "abc\ndef", tok.Literal)
+	}
+
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+}
+
+func TestShebangLine(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedType token.Type
+		expectedLine int
+	}{
+		{"#!/usr/bin/env amoeba\nlet x = 1;", token.LET, 2},
+		{"#!/usr/bin/env amoeba", token.EOF, 1},
+		{"let x = 1;\n#!not a shebang", token.LET, 1},
+	}
+
+	for _, test := range tests {
+		tok := New(test.input).NextToken()
+
+		if tok.Type != test.expectedType {
+			t.Errorf("%q - tokentype wrong. expected=%q, got=%q", test.input, test.expectedType, tok.Type)
+		}
+		if tok.Pos.Line != test.expectedLine || tok.Pos.Column != 1 && tok.Type != token.EOF {
+			t.Errorf("%q - position wrong. expected=%d:1, got=%s", test.input, test.expectedLine, tok.Pos)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 10 / 2; // half
+/* a block
+   over lines */ x /= /**/ 2;
+x // end`
+
+	expectedTokens := []struct {
+		expectedType token.Type
+		expectedPos  string
+	}{
+		{token.LET, "2:1"},
+		{token.IDENT, "2:5"},
+		{token.ASSIGN, "2:7"},
+		{token.INT, "2:9"},
+		{token.SLASH, "2:12"},
+		{token.INT, "2:14"},
+		{token.SEMICOLON, "2:15"},
+		{token.IDENT, "4:18"},
+		{token.SLASH_ASSIGN, "4:20"},
+		{token.INT, "4:28"},
+		{token.SEMICOLON, "4:29"},
+		{token.IDENT, "5:1"},
+		{token.EOF, "5:9"},
+	}
+
+	l := New(input)
+	for i, tt := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("test [%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos.String() != tt.expectedPos {
+			t.Fatalf("test [%d] - position wrong. expected=%s, got=%s", i, tt.expectedPos, tok.Pos)
+		}
+	}
+
+	expectedComments := []token.Comment{
+		{Text: "// leading", Pos: token.Position{Line: 1, Column: 1}},
+		{Text: "// half", Pos: token.Position{Line: 2, Column: 17}},
+		{Text: "/* a block\n   over lines */", Pos: token.Position{Line: 3, Column: 1}},
+		{Text: "/**/", Pos: token.Position{Line: 4, Column: 23}},
+		{Text: "// end", Pos: token.Position{Line: 5, Column: 3}},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, expected := range expectedComments {
+		if comments[i] != expected {
+			t.Errorf("comment [%d] wrong. expected=%+v, got=%+v", i, expected, comments[i])
+		}
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	l := New("x /* never\nclosed")
+
+	if tok := l.NextToken(); tok.Type != token.IDENT {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.IDENT, tok.Type)
+	}
+
+	tok := l.NextToken()
+	if tok.Type != token.UNTERMINATED_COMMENT {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.UNTERMINATED_COMMENT, tok.Type)
+	}
+	if tok.Literal != "/* never\nclosed" || tok.Pos.String() != "1:3" {
+		t.Fatalf("token wrong. got=%q at %s", tok.Literal, tok.Pos)
+	}
+
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.Type
+		expectedLiteral string
+		expectedPos     string
+	}{
+		{`"a\nb\tc\rd"`, token.STRING, "a\nb\tc\rd", "1:1"},
+		{`"say \"hi\" \\ bye"`, token.STRING, `say "hi" \ bye`, "1:1"},
+		{`"nul\0"`, token.STRING, "nul\x00", "1:1"},
+		{`"\u{48}\u{e9}\u{1F600}"`, token.STRING, "Hé😀", "1:1"},
+		{`"héllo"`, token.STRING, "héllo", "1:1"},
+		{`"bad \q here"`, token.INVALID_ESCAPE, `\q`, "1:6"},
+		{`"\u{110000}"`, token.INVALID_ESCAPE, `\u{110000}`, "1:2"},
+		{`"\u{}"`, token.INVALID_ESCAPE, `\u{`, "1:2"},
+		{`"\u00e9"`, token.INVALID_ESCAPE, `\u`, "1:2"},
+		{`"ends with \"`, token.UNTERMINATED_STRING, `ends with "`, "1:1"},
+		{"`raw \\n \"quoted\"\nlines`", token.RAW_STRING, "raw \\n \"quoted\"\nlines", "1:1"},
+		{"`crlf\r\nline`", token.RAW_STRING, "crlf\nline", "1:1"},
+		{"`never closed", token.UNTERMINATED_STRING, "never closed", "1:1"},
+	}
+
+	for _, test := range tests {
+		l := New(test.input)
+		tok := l.NextToken()
+
+		if tok.Type != test.expectedType {
+			t.Errorf("%s - tokentype wrong. expected=%q, got=%q", test.input, test.expectedType, tok.Type)
+			continue
+		}
+		if tok.Literal != test.expectedLiteral {
+			t.Errorf("%s - literal wrong. expected=%q, got=%q", test.input, test.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.String() != test.expectedPos {
+			t.Errorf("%s - position wrong. expected=%s, got=%s", test.input, test.expectedPos, tok.Pos)
+		}
+
+		// the string itself still follows an invalid escape
+		next := l.NextToken()
+		if tok.Type == token.INVALID_ESCAPE {
+			if next.Type != token.STRING {
+				t.Errorf("%s - expected the string after the invalid escape, got %q", test.input, next.Type)
+			}
+			next = l.NextToken()
+		}
+		if next.Type != token.EOF {
+			t.Errorf("%s - expected the string to be the only token, got %q after it", test.input, next.Type)
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	input := `"total: ${sum(a) + 1}!" "${ {"k": 1}["k"] } and ${"in${x}ner"}" "\${x} $x"`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+		expectedPos     string
+	}{
+		{token.TEMPLATE_HEAD, "total: ", "1:1"},
+		{token.IDENT, "sum", "1:11"},
+		{token.LPAREN, "(", "1:14"},
+		{token.IDENT, "a", "1:15"},
+		{token.RPAREN, ")", "1:16"},
+		{token.PLUS, "+", "1:18"},
+		{token.INT, "1", "1:20"},
+		{token.TEMPLATE_TAIL, "!", "1:21"},
+		{token.TEMPLATE_HEAD, "", "1:25"},
+		{token.LBRACE, "{", "1:29"},
+		{token.STRING, "k", "1:30"},
+		{token.COLON, ":", "1:33"},
+		{token.INT, "1", "1:35"},
+		{token.RBRACE, "}", "1:36"},
+		{token.LBRACKET, "[", "1:37"},
+		{token.STRING, "k", "1:38"},
+		{token.RBRACKET, "]", "1:41"},
+		{token.TEMPLATE_MIDDLE, " and ", "1:43"},
+		{token.TEMPLATE_HEAD, "in", "1:51"},
+		{token.IDENT, "x", "1:56"},
+		{token.TEMPLATE_TAIL, "ner", "1:57"},
+		{token.TEMPLATE_TAIL, "", "1:62"},
+		{token.STRING, "${x} $x", "1:65"},
+		{token.EOF, "", "1:75"},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test [%d] - token wrong. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Pos.String() != tt.expectedPos {
+			t.Fatalf("test [%d] - position wrong. expected=%s, got=%s", i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
@@ -3,9 +3,9 @@ package main
 import (
 	"os"
 
-	"github.com/ASteinheiser/amoeba-interpreter/repl"
+	"github.com/ASteinheiser/amoeba-interpreter/cli"
 )
 
 func main() {
-	repl.Start(os.Stdin, os.Stdout)
+	os.Exit(cli.Main(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
@@ -1,5 +1,7 @@
 package object
 
+import "sort"
+
 // NewEnvironment creates a newly scoped environment
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
@@ -33,3 +35,34 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Assign will update the value of an existing identifier in the
+// innermost environment that defines it, returning false if none do
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return val, true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return nil, false
+}
+
+// Names returns every identifier visible from the environment,
+// including those of outer environments, sorted
+func (e *Environment) Names() []string {
+	seen := make(map[string]bool)
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,9 +3,13 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/code"
+	"github.com/ASteinheiser/amoeba-interpreter/style"
+	"github.com/ASteinheiser/amoeba-interpreter/token"
 )
 
 // Type is the type of an object
@@ -14,12 +18,16 @@ type Type string
 const (
 	// INTEGER_OBJ is the object type for integers
 	INTEGER_OBJ = "INTEGER"
+	// FLOAT_OBJ is the object type for floating-point numbers
+	FLOAT_OBJ = "FLOAT"
 	// BOOLEAN_OBJ is the object type for booleans
 	BOOLEAN_OBJ = "BOOLEAN"
 	// NULL_OBJ is the object type for nulls
 	NULL_OBJ = "NULL"
 	// RETURN_VALUE_OBJ is the object type for return values
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	// TAIL_CALL_OBJ is the object type for calls deferred to the caller
+	TAIL_CALL_OBJ = "TAIL_CALL"
 	// ERROR_OBJ is the object type for errors
 	ERROR_OBJ = "ERROR"
 	// FUNCTION_OBJ is the object type for functions
@@ -32,6 +40,12 @@ const (
 	ARRAY_OBJ = "ARRAY"
 	// HASH_OBJ is the object type for hashes
 	HASH_OBJ = "HASH"
+	// BREAK_OBJ is the object type for break signals
+	BREAK_OBJ = "BREAK"
+	// CONTINUE_OBJ is the object type for continue signals
+	CONTINUE_OBJ = "CONTINUE"
+	// COMPILED_FUNCTION_OBJ is the object type for functions compiled to bytecode
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 // BuiltinFunction is the type for functions defined by the interpreter
@@ -43,6 +57,20 @@ type Object interface {
 	Inspect() string
 }
 
+// HashKey identifies the value of a hashable object, keys of
+// different types never match even if their values do
+type HashKey struct {
+	Type  Type
+	Value uint64
+	Text  string // the whole string for strings, so no two strings share a key
+}
+
+// Hashable is an object that can be used as the key of a hash
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
 // Integer is the object that holds integers
 type Integer struct {
 	Value int64
@@ -54,6 +82,29 @@ func (i *Integer) Inspect() string { return fmt.Sprintf("%d", i.Value) }
 // Type returns the type string for the integer
 func (i *Integer) Type() Type { return INTEGER_OBJ }
 
+// HashKey returns the key for using the integer in a hash
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// Float is the object that holds floating-point numbers
+type Float struct {
+	Value float64
+}
+
+// Inspect returns a formatted string with the value of the float,
+// always including a decimal point for whole numbers
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// Type returns the type string for the float
+func (f *Float) Type() Type { return FLOAT_OBJ }
+
 // Boolean is the object that holds booleans
 type Boolean struct {
 	Value bool
@@ -65,6 +116,15 @@ func (b *Boolean) Inspect() string { return fmt.Sprintf("%t", b.Value) }
 // Type returns the type string for the boolean
 func (b *Boolean) Type() Type { return BOOLEAN_OBJ }
 
+// HashKey returns the key for using the boolean in a hash
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
 // Null is the object that holds nulls
 type Null struct{}
 
@@ -85,46 +145,203 @@ func (rv *ReturnValue) Inspect() string { return rv.Value.Inspect() }
 // Type returns the type string for the return value
 func (rv *ReturnValue) Type() Type { return RETURN_VALUE_OBJ }
 
+// TailCall is the object returned by `return f(...)`, the function is
+// called by whoever called the function returning it, so tail calls
+// run in a loop instead of growing the stack
+type TailCall struct {
+	Function  Object
+	Arguments []Object
+	Pos       token.Position // position of the call
+	CalleePos token.Position // position of the function being called
+}
+
+// Inspect returns a string describing the tail call
+func (tc *TailCall) Inspect() string { return "tail call to " + tc.Function.Inspect() }
+
+// Type returns the type string for the tail call
+func (tc *TailCall) Type() Type { return TAIL_CALL_OBJ }
+
+// Break is the object that signals the innermost loop to stop
+type Break struct{}
+
+// Inspect returns a string for the break signal
+func (b *Break) Inspect() string { return "break" }
+
+// Type returns the type string for the break signal
+func (b *Break) Type() Type { return BREAK_OBJ }
+
+// Continue is the object that signals the innermost loop
+// to start its next iteration
+type Continue struct{}
+
+// Inspect returns a string for the continue signal
+func (c *Continue) Inspect() string { return "continue" }
+
+// Type returns the type string for the continue signal
+func (c *Continue) Type() Type { return CONTINUE_OBJ }
+
 // Error is the object that holds internal error messages
 type Error struct {
 	Message string
+	Pos     token.Position // where in the source the error occurred
+	Trace   []StackFrame   // function calls the error passed through, innermost first
+	Limit   Limit          // the execution limit that stopped the program, if any
 }
 
-// Inspect returns a string with the message of the error
-func (e *Error) Inspect() string { return "ERROR: " + e.Message }
+// Limit names an execution limit that can stop a program, errors
+// raised by the program itself have no limit
+type Limit string
+
+const (
+	// NoLimit is the limit of errors raised by the program itself
+	NoLimit Limit = ""
+	// StepLimit is tripped by evaluating too many nodes
+	StepLimit Limit = "steps"
+	// DepthLimit is tripped by nesting too many function calls
+	DepthLimit Limit = "depth"
+	// ContextLimit is tripped when the context of a run is cancelled
+	// or reaches its deadline
+	ContextLimit Limit = "context"
+)
+
+// Inspect returns a string with the position and message of the
+// error, followed by a traceback of the calls it passed through
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("ERROR: ")
+	if e.Pos.IsValid() {
+		out.WriteString(e.Pos.String() + ": ")
+	}
+	out.WriteString(e.Message)
+
+	for i := 0; i < len(e.Trace); {
+		frame := e.Trace[i]
+
+		// collapse runs of the same frame, which recursion produces a lot of
+		repeated := 0
+		for i+repeated+1 < len(e.Trace) && e.Trace[i+repeated+1] == frame {
+			repeated++
+		}
+
+		out.WriteString("\n    " + frame.String())
+		if repeated > 0 {
+			out.WriteString(fmt.Sprintf("\n    ... repeated %d more times", repeated))
+		}
+
+		i += repeated + 1
+	}
+
+	return out.String()
+}
 
 // Type returns the type string for the error
 func (e *Error) Type() Type { return ERROR_OBJ }
 
+// StackFrame is a single function call recorded in the traceback of an Error
+type StackFrame struct {
+	Function string         // name of the called function, empty when anonymous
+	Pos      token.Position // where the function was called from
+}
+
+// String returns the frame formatted for a traceback
+func (sf StackFrame) String() string {
+	name := sf.Function
+	if name == "" {
+		name = "<anonymous fn>"
+	}
+	return "in " + name + ", called at " + sf.Pos.String()
+}
+
 // Function is the object that holds the reference to an executable function
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string // name of the let binding, empty when anonymous
 }
 
 // Type returns the type string for the function
 func (f *Function) Type() Type { return FUNCTION_OBJ }
 
 // Inspect returns a string representing the function
-func (f *Function) Inspect() string {
-	var out bytes.Buffer
-
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+func (f *Function) Inspect() string { return inspectFunction(f.Parameters, f.Body) }
+
+// inspectFunction writes a function out with a statement on each line,
+// the way the ast prints them. The REPL shows functions with the
+// formatter instead, which object can't depend on
+func inspectFunction(parameters []*ast.Identifier, body *ast.BlockStatement) string {
+	params := make([]string, len(parameters))
+	for i, p := range parameters {
+		params[i] = p.String()
 	}
 
-	out.WriteString("fn")
-	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
+	var out strings.Builder
+	out.WriteString("fn(" + strings.Join(params, ", ") + ") {")
+	if len(body.Statements) == 0 {
+		out.WriteString("}")
+		return out.String()
+	}
+	for _, stmt := range body.Statements {
+		out.WriteString("\n" + style.Indent + stmt.String())
+	}
 	out.WriteString("\n}")
 
 	return out.String()
 }
 
+// CompiledFunction is a function literal compiled to bytecode. Each one
+// carries its own constants and refs, so closures from imported files
+// run the same as closures from the file that calls them
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Constants     []Object
+	Refs          []code.Ref
+	NumSlots      int // parameters first, then every let in the body
+	NumParameters int
+	Name          string
+
+	// Positions maps instruction offsets to the node they were compiled
+	// from, CallSites maps call instructions to the position of the callee
+	Positions map[int]token.Position
+	CallSites map[int]token.Position
+
+	// the literal is kept so closures inspect the same as functions
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+}
+
+// Type returns the type string for the compiled function
+func (cf *CompiledFunction) Type() Type { return COMPILED_FUNCTION_OBJ }
+
+// Inspect returns a string representing the compiled function
+func (cf *CompiledFunction) Inspect() string {
+	if cf.Body == nil {
+		return fmt.Sprintf("CompiledFunction[%p]", cf)
+	}
+	return inspectFunction(cf.Parameters, cf.Body)
+}
+
+// Scope holds the variables of one call of a compiled function, or the
+// top level of a program, with Parent being the scope it was defined in
+type Scope struct {
+	Slots  []Object // unset variables are nil
+	Parent *Scope
+}
+
+// Closure is a compiled function along with the scope it was defined in
+type Closure struct {
+	Fn    *CompiledFunction
+	Scope *Scope
+}
+
+// Type returns the type string for the closure, which is a
+// function as far as programs can tell
+func (c *Closure) Type() Type { return FUNCTION_OBJ }
+
+// Inspect returns a string representing the closure
+func (c *Closure) Inspect() string { return c.Fn.Inspect() }
+
 // String is the object that holds strings
 type String struct {
 	Value string
@@ -136,6 +353,11 @@ func (s *String) Inspect() string { return s.Value }
 // Type returns the type string for the string
 func (s *String) Type() Type { return STRING_OBJ }
 
+// HashKey returns the key for using the string in a hash
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Text: s.Value}
+}
+
 // Builtin is the object that holds builtin functions
 type Builtin struct {
 	Fn BuiltinFunction
@@ -152,45 +374,57 @@ type Array struct {
 	Elements []Object
 }
 
-// Inspect returns a string representing the array
-func (ao *Array) Inspect() string {
-	var out bytes.Buffer
-
-	elements := []string{}
-	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
-	}
-
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-
-	return out.String()
-}
+// Inspect returns a string representing the array, on one line
+func (ao *Array) Inspect() string { return Pretty(ao, 0) }
 
 // Type returns the type string for the array
 func (ao *Array) Type() Type { return ARRAY_OBJ }
 
+// HashPair is a single entry of a hash, keeping
+// the original key object alongside the value
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
 // Hash is the object that holds hashes
 type Hash struct {
-	Pairs map[string]Object
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey // in the order they were first set
 }
 
-// Inspect returns a string representing the hash
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
+// NewHash creates an empty hash
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
 
-	pairs := []string{}
-	for key, val := range h.Pairs {
-		pairs = append(pairs, key+":"+val.Inspect())
-	}
+// Get returns the value stored for a key if it exists
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
+// Set stores the value for a key, keys that already exist
+// keep their original place in the iteration order
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.Keys = append(h.Keys, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key, Value: value}
+}
 
-	return out.String()
+// Ordered returns the pairs of the hash in insertion order
+func (h *Hash) Ordered() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Keys))
+	for _, key := range h.Keys {
+		pairs = append(pairs, h.Pairs[key])
+	}
+	return pairs
 }
 
+// Inspect returns a string representing the hash, on one line
+func (h *Hash) Inspect() string { return Pretty(h, 0) }
+
 // Type returns the type string for the hash
 func (h *Hash) Type() Type { return HASH_OBJ }
@@ -0,0 +1,152 @@
+package object
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ASteinheiser/amoeba-interpreter/style"
+)
+
+// DefaultWidth is the number of columns values are fitted into when
+// the REPL shows them or print writes them
+const DefaultWidth = style.Width
+
+// Pretty returns obj written the way it would be in source, with strings
+// quoted. Arrays and hashes that don't fit in width columns are broken
+// up with one element per line, indented by style.Indent, and ones that
+// contain themselves show as [...] or {...} where they would repeat. A
+// width of zero or less keeps everything on one line
+func Pretty(obj Object, width int) string {
+	p := &prettyPrinter{width: width}
+	return p.print(obj, 0, 0, 0)
+}
+
+// prettyPrinter keeps track of the arrays and hashes it is inside of,
+// to find the ones that contain themselves
+type prettyPrinter struct {
+	width   int
+	parents []Object
+}
+
+// print returns obj starting at column col of a line indented by
+// indent, with suffix columns still to come on the line after it
+func (p *prettyPrinter) print(obj Object, indent, col, suffix int) string {
+	flat := p.flat(obj)
+	if p.width <= 0 || p.fits(flat, col+suffix) {
+		return flat
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		if len(obj.Elements) == 0 || p.isParent(obj) {
+			return flat
+		}
+		p.enter(obj)
+		defer p.leave()
+
+		lines := make([]string, len(obj.Elements))
+		for i, el := range obj.Elements {
+			lines[i] = p.print(el, indent+1, p.column(indent+1), p.commaAfter(i, len(obj.Elements)))
+		}
+		return p.wrap("[", lines, "]", indent)
+
+	case *Hash:
+		if len(obj.Keys) == 0 || p.isParent(obj) {
+			return flat
+		}
+		p.enter(obj)
+		defer p.leave()
+
+		pairs := obj.Ordered()
+		lines := make([]string, len(pairs))
+		for i, pair := range pairs {
+			key := p.flat(pair.Key) + ": "
+			value := p.print(pair.Value, indent+1, p.column(indent+1)+utf8.RuneCountInString(key), p.commaAfter(i, len(pairs)))
+			lines[i] = key + value
+		}
+		return p.wrap("{", lines, "}", indent)
+
+	default:
+		// functions take up several lines, which have to
+		// line up with wherever they are printed
+		return strings.Replace(flat, "\n", "\n"+strings.Repeat(style.Indent, indent), -1)
+	}
+}
+
+// flat returns obj with everything on one line, apart from the
+// bodies of functions
+func (p *prettyPrinter) flat(obj Object) string {
+	switch obj := obj.(type) {
+	case *String:
+		return style.Quote(obj.Value)
+
+	case *Array:
+		if p.isParent(obj) {
+			return "[...]"
+		}
+		p.enter(obj)
+		defer p.leave()
+
+		elements := make([]string, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = p.flat(el)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+
+	case *Hash:
+		if p.isParent(obj) {
+			return "{...}"
+		}
+		p.enter(obj)
+		defer p.leave()
+
+		pairs := make([]string, 0, len(obj.Keys))
+		for _, pair := range obj.Ordered() {
+			pairs = append(pairs, p.flat(pair.Key)+": "+p.flat(pair.Value))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+
+	default:
+		return obj.Inspect()
+	}
+}
+
+// fits reports whether s is a single line that fits in the width
+// when it starts at column col
+func (p *prettyPrinter) fits(s string, col int) bool {
+	return !strings.Contains(s, "\n") && col+utf8.RuneCountInString(s) <= p.width
+}
+
+// wrap puts each of lines on its own line between open and close
+func (p *prettyPrinter) wrap(open string, lines []string, close string, indent int) string {
+	inner := "\n" + strings.Repeat(style.Indent, indent+1)
+	return open + inner + strings.Join(lines, ","+inner) + "\n" + strings.Repeat(style.Indent, indent) + close
+}
+
+// column is where a line indented by indent starts
+func (p *prettyPrinter) column(indent int) int {
+	return indent * len(style.Indent)
+}
+
+// commaAfter is how many columns follow element i of n, the comma
+// separating it from the next one
+func (p *prettyPrinter) commaAfter(i, n int) int {
+	if i < n-1 {
+		return 1
+	}
+	return 0
+}
+
+func (p *prettyPrinter) enter(obj Object) { p.parents = append(p.parents, obj) }
+
+func (p *prettyPrinter) leave() { p.parents = p.parents[:len(p.parents)-1] }
+
+// isParent reports whether obj is being printed already, further out
+func (p *prettyPrinter) isParent(obj Object) bool {
+	for _, parent := range p.parents {
+		if parent == obj {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package object
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+)
+
+func str(s string) *String { return &String{Value: s} }
+
+func integer(i int64) *Integer { return &Integer{Value: i} }
+
+func array(elements ...Object) *Array { return &Array{Elements: elements} }
+
+func hash(pairs ...Object) *Hash {
+	h := NewHash()
+	for i := 0; i < len(pairs); i += 2 {
+		h.Set(pairs[i].(Hashable), pairs[i+1])
+	}
+	return h
+}
+
+func function(input string) *Function {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	literal := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	return &Function{Parameters: literal.Parameters, Body: literal.Body}
+}
+
+func TestPretty(t *testing.T) {
+	long := array()
+	for i := int64(0); i < 30; i++ {
+		long.Elements = append(long.Elements, integer(i))
+	}
+
+	tests := []struct {
+		obj      Object
+		width    int
+		expected string
+	}{
+		{integer(4), 80, "4"},
+		{&Float{Value: 2}, 80, "2.0"},
+		{&Null{}, 80, "null"},
+		{str("say \"hi\"\n"), 80, `"say \"hi\"\n"`},
+		{str("${x}"), 80, `"\${x}"`},
+		{array(), 80, "[]"},
+		{hash(), 80, "{}"},
+		{array(str("a"), integer(1), &Boolean{Value: true}), 80, `["a", 1, true]`},
+		{hash(str("a"), integer(1), integer(2), str("b")), 80, `{"a": 1, 2: "b"}`},
+		{array(integer(1), integer(2)), 6, "[1, 2]"},
+		{array(integer(1), integer(2)), 5, "[\n  1,\n  2\n]"},
+		{long, 0, long.Inspect()},
+		// only what doesn't fit is broken up
+		{
+			array(array(integer(1), integer(2)), str("a long string that won't fit")),
+			30,
+			"[\n  [1, 2],\n  \"a long string that won't fit\"\n]",
+		},
+		// the comma after an element counts towards its width
+		{array(array(integer(1), integer(2)), integer(3)), 9, "[\n  [1, 2],\n  3\n]"},
+		{array(array(integer(1), integer(2)), integer(3)), 8, "[\n  [\n    1,\n    2\n  ],\n  3\n]"},
+		{
+			hash(str("key"), array(integer(100), integer(200)), str("other"), integer(1)),
+			18,
+			"{\n  \"key\": [\n    100,\n    200\n  ],\n  \"other\": 1\n}",
+		},
+		{
+			hash(str("k"), array(integer(100), integer(200)), str("other"), integer(1)),
+			20,
+			"{\n  \"k\": [100, 200],\n  \"other\": 1\n}",
+		},
+	}
+
+	for _, test := range tests {
+		if output := Pretty(test.obj, test.width); output != test.expected {
+			t.Errorf("Pretty(%s, %d) wrong.\nexpected=\n%s\ngot=\n%s", test.obj.Inspect(), test.width, test.expected, output)
+		}
+	}
+}
+
+func TestPrettyCycles(t *testing.T) {
+	a := array(integer(1))
+	a.Elements = append(a.Elements, a)
+
+	h := hash(str("self"), integer(0))
+	h.Set(str("self"), h)
+	h.Set(str("list"), array(h, a))
+
+	tests := []struct {
+		obj      Object
+		width    int
+		expected string
+	}{
+		{a, 80, "[1, [...]]"},
+		{a, 0, "[1, [...]]"},
+		{h, 80, `{"self": {...}, "list": [{...}, [1, [...]]]}`},
+		{h, 20, "{\n  \"self\": {...},\n  \"list\": [\n    {...},\n    [1, [...]]\n  ]\n}"},
+	}
+
+	for _, test := range tests {
+		if output := Pretty(test.obj, test.width); output != test.expected {
+			t.Errorf("Pretty(%d) wrong.\nexpected=\n%s\ngot=\n%s", test.width, test.expected, output)
+		}
+	}
+
+	// the same array twice isn't a cycle
+	shared := array(integer(1))
+	if output := Pretty(array(shared, shared), 80); output != "[[1], [1]]" {
+		t.Errorf("shared array printed wrong, got=%s", output)
+	}
+}
+
+func TestPrettyFunctions(t *testing.T) {
+	fn := function("fn(x, y) { let z = x + y; z * 2 }")
+
+	expected := "fn(x, y) {\n  let z = (x + y);\n  (z * 2)\n}"
+	if output := Pretty(fn, 80); output != expected {
+		t.Errorf("function printed wrong.\nexpected=\n%s\ngot=\n%s", expected, output)
+	}
+
+	// a function in a hash lines up with the key it belongs to
+	expected = "{\n  \"double\": fn(x, y) {\n    let z = (x + y);\n    (z * 2)\n  }\n}"
+	if output := Pretty(hash(str("double"), fn), 80); output != expected {
+		t.Errorf("function in a hash printed wrong.\nexpected=\n%s\ngot=\n%s", expected, output)
+	}
+
+	if output := Pretty(array(fn), 0); !strings.HasPrefix(output, "[fn(x, y) {\n") {
+		t.Errorf("function in an array printed wrong, got=%s", output)
+	}
+}
@@ -10,20 +10,28 @@ import (
 )
 
 const (
-	// assigns values 1-7 to constants (_ gets the 0)
+	// assigns values 1-9 to constants (_ gets the 0)
 	_ int = iota
 	// LOWEST is the lowest precedence operator
 	LOWEST
+	// ASSIGN is = or +=
+	ASSIGN
+	// OR is ||
+	OR
+	// AND is &&
+	AND
 	// EQUALS is ==
 	EQUALS
-	// LESSGREATER is > or <
+	// LESSGREATER is > or <=
 	LESSGREATER
 	// SUM is +
 	SUM
-	// PRODUCT is *
+	// PRODUCT is * or %
 	PRODUCT
 	// PREFIX is -x or !x
 	PREFIX
+	// POSTFIX is x++
+	POSTFIX
 	// CALL is myFn(x)
 	CALL
 	// INDEX is array[index]
@@ -31,16 +39,29 @@ const (
 )
 
 var precedences = map[token.Type]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.INCREMENT:       POSTFIX,
+	token.DECREMENT:       POSTFIX,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 // Parser contains the lexer and parses tokens one at a time,
@@ -53,13 +74,19 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
-	prefixParseFns map[token.Type]prefixParseFn
-	infixParseFns  map[token.Type]infixParseFn
+	// number of loops enclosing the current token within
+	// the current function, used to validate break and continue
+	loopDepth int
+
+	prefixParseFns  map[token.Type]prefixParseFn
+	infixParseFns   map[token.Type]infixParseFn
+	postfixParseFns map[token.Type]postfixParseFn
 }
 
 type (
-	prefixParseFn func() ast.Expression
-	infixParseFn  func(ast.Expression) ast.Expression
+	prefixParseFn  func() ast.Expression
+	infixParseFn   func(ast.Expression) ast.Expression
+	postfixParseFn func(ast.Expression) ast.Expression
 )
 
 // New creates a new Parser from a given lexer
@@ -72,6 +99,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.Type]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
@@ -80,21 +108,41 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.RAW_STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE_HEAD, p.parseTemplateLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
+	p.registerPrefix(token.INCREMENT, p.parsePrefixUpdateExpression)
+	p.registerPrefix(token.DECREMENT, p.parsePrefixUpdateExpression)
 
 	p.infixParseFns = make(map[token.Type]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
+	p.postfixParseFns = make(map[token.Type]postfixParseFn)
+	p.registerPostfix(token.INCREMENT, p.parsePostfixUpdateExpression)
+	p.registerPostfix(token.DECREMENT, p.parsePostfixUpdateExpression)
+
 	// initialize both tokens by reading twice
 	p.nextToken()
 	p.nextToken()
@@ -126,12 +174,28 @@ func (p *Parser) Errors() []string {
 func (p *Parser) peekError(t token.Type) {
 	msg := fmt.Sprintf("expected '%s' to be %s, got %s instead",
 		p.peekToken.Literal, t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken.Pos, msg)
+}
+
+// addError records a parser error prefixed with the position it occurred at
+func (p *Parser) addError(pos token.Position, msg string) {
+	p.errors = append(p.errors, pos.String()+": "+msg)
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	switch p.peekToken.Type {
+	case token.UNTERMINATED_COMMENT:
+		// a comment running into the end of the input leaves nothing after it
+		p.addError(p.peekToken.Pos, "unterminated comment")
+		p.peekToken = token.Token{Type: token.EOF, Pos: p.peekToken.Pos}
+	case token.INVALID_ESCAPE:
+		// the string it was found in comes next, and parses as usual
+		p.addError(p.peekToken.Pos, fmt.Sprintf("invalid escape sequence %s in string", p.peekToken.Literal))
+		p.peekToken = p.l.NextToken()
+	}
 }
 
 func (p *Parser) curTokenIs(t token.Type) bool {
@@ -157,6 +221,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -166,6 +236,27 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	template := &ast.TemplateLiteral{Token: p.curToken, Strings: []string{p.curToken.Literal}}
+
+	for {
+		p.nextToken()
+		template.Expressions = append(template.Expressions, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.TEMPLATE_MIDDLE) && !p.peekTokenIs(token.TEMPLATE_TAIL) {
+			p.peekError(token.RBRACE)
+			return nil
+		}
+
+		p.nextToken()
+		template.Strings = append(template.Strings, p.curToken.Literal)
+
+		if p.curTokenIs(token.TEMPLATE_TAIL) {
+			return template
+		}
+	}
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
@@ -183,6 +274,12 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// name function literals after the identifier they are bound to,
+	// so they can be referred to in stack traces
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -204,6 +301,111 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	body, ok := p.parseLoopBody()
+	if !ok {
+		return nil
+	}
+
+	stmt.Body = body
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	// a statement consumes its own trailing semicolon,
+	// so afterwards the current token should be the ;
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Init = p.parseStatement()
+		if !p.curTokenIs(token.SEMICOLON) {
+			p.peekError(token.SEMICOLON)
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Condition = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Update = p.parseStatement()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	body, ok := p.parseLoopBody()
+	if !ok {
+		return nil
+	}
+
+	stmt.Body = body
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() (*ast.BlockStatement, bool) {
+	if !p.expectPeek(token.LBRACE) {
+		return nil, false
+	}
+
+	p.loopDepth++
+	body, ok := p.parseBlockStatement()
+	p.loopDepth--
+
+	// loops are statements, so like the others they can end with a semicolon
+	if ok && p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return body, ok
+}
+
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+
+	if p.loopDepth == 0 {
+		p.addError(tok.Pos, fmt.Sprintf("%s outside of a loop", tok.Literal))
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -225,6 +427,17 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	leftExp := prefix()
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+		if postfix := p.postfixParseFns[p.peekToken.Type]; postfix != nil {
+			// on the next line it belongs to the next statement instead,
+			// so x and ++y on separate lines aren't read as x++ y
+			if p.peekToken.Pos.Line != p.curToken.Pos.Line {
+				return leftExp
+			}
+			p.nextToken()
+			leftExp = postfix(leftExp)
+			continue
+		}
+
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -246,9 +459,22 @@ func (p *Parser) registerInfix(tokenType token.Type, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+func (p *Parser) registerPostfix(tokenType token.Type, fn postfixParseFn) {
+	p.postfixParseFns[tokenType] = fn
+}
+
 func (p *Parser) noPrefixParseFnError(t token.Type) {
+	switch t {
+	case token.UNTERMINATED_STRING:
+		p.addError(p.curToken.Pos, "unterminated string")
+		return
+	case token.TEMPLATE_MIDDLE, token.TEMPLATE_TAIL:
+		p.addError(p.curToken.Pos, "missing expression in ${} of string")
+		return
+	}
+
 	msg := fmt.Sprintf("no prefix parsing fn for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken.Pos, msg)
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
@@ -265,7 +491,22 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as an integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken.Pos, msg)
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as a float", p.curToken.Literal)
+		p.addError(p.curToken.Pos, msg)
 		return nil
 	}
 
@@ -349,6 +590,7 @@ func (p *Parser) parseBlockStatement() (*ast.BlockStatement, bool) {
 		p.peekError(token.RBRACE)
 		ok = false
 	}
+	block.End = p.curToken.Pos
 
 	return block, ok
 }
@@ -366,6 +608,45 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parsePrefixUpdateExpression() ast.Expression {
+	expression := &ast.UpdateExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Prefix:   true,
+	}
+
+	p.nextToken()
+
+	expression.Target = p.parseExpression(PREFIX)
+
+	return p.checkUpdateTarget(expression)
+}
+
+func (p *Parser) parsePostfixUpdateExpression(target ast.Expression) ast.Expression {
+	expression := &ast.UpdateExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
+	}
+
+	return p.checkUpdateTarget(expression)
+}
+
+// checkUpdateTarget makes sure ++ and -- are only used on
+// the same identifiers and indexes that can be assigned to
+func (p *Parser) checkUpdateTarget(expression *ast.UpdateExpression) ast.Expression {
+	switch expression.Target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		return expression
+	case nil:
+		// the target failed to parse and already reported an error
+		return nil
+	default:
+		p.addError(expression.Token.Pos, fmt.Sprintf("cannot apply %s to %s", expression.Operator, expression.Target.String()))
+		return nil
+	}
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{
 		Token:    p.curToken,
@@ -380,20 +661,44 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
-func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
 	}
-	return LOWEST
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case nil:
+		// the target failed to parse and already reported an error
+		return nil
+	default:
+		p.addError(p.curToken.Pos, fmt.Sprintf("cannot assign to %s", target.String()))
+		return nil
+	}
+
+	// parse the value with a lower precedence so that
+	// assignments are right associative: a = (b = c)
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
 }
 
-func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
+// Precedence returns how tightly the infix operator t binds,
+// or LOWEST when t isn't an infix operator
+func Precedence(t token.Type) int {
+	if p, ok := precedences[t]; ok {
 		return p
 	}
 	return LOWEST
 }
 
+func (p *Parser) peekPrecedence() int { return Precedence(p.peekToken.Type) }
+
+func (p *Parser) curPrecedence() int { return Precedence(p.curToken.Type) }
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	function := &ast.FunctionLiteral{Token: p.curToken}
 
@@ -407,7 +712,11 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// loops around a function literal can't be broken out of from inside it
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	body, ok := p.parseBlockStatement()
+	p.loopDepth = loopDepth
 	if !ok {
 		return nil
 	}
@@ -448,6 +757,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.End = p.curToken.Pos
 	return exp
 }
 
@@ -478,6 +788,7 @@ func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.End = p.curToken.Pos
 	return array
 }
 
@@ -496,7 +807,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
+	hash.Pairs = []ast.HashPair{}
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
@@ -509,7 +820,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		val := p.parseExpression(LOWEST)
 
-		hash.Pairs[key] = val
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: val})
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -519,6 +830,19 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.End = p.curToken.Pos
 
 	return hash
 }
+
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	exp.Path = p.curToken.Literal
+
+	return exp
+}
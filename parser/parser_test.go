@@ -231,6 +231,40 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 	return true
 }
 
+func TestFloatExpression(t *testing.T) {
+	input := "3.25;"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected program to have 1 statement, got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not a *ast.ExpressionStatement, got=%T",
+			program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not a *ast.FloatLiteral, got=%T", stmt.Expression)
+	}
+
+	if literal.Value != 3.25 {
+		t.Errorf("literal.Value was not 3.25, got=%g", literal.Value)
+	}
+
+	if literal.TokenLiteral() != "3.25" {
+		t.Errorf("literal.TokenLiteral() was not \"3.25\", got=%q", literal.TokenLiteral())
+	}
+}
+
 func TestStringExpression(t *testing.T) {
 	input := `"hello world!"`
 	expected := "hello world!"
@@ -256,6 +290,49 @@ func TestStringExpression(t *testing.T) {
 	}
 }
 
+func TestTemplateLiteralParsing(t *testing.T) {
+	input := `"sum: ${a + b}, ${"nested ${c}"}!"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not a *ast.ExpressionStatement, got=%T",
+			program.Statements[0])
+	}
+
+	template, ok := stmt.Expression.(*ast.TemplateLiteral)
+	if !ok {
+		t.Fatalf("exp is not a *ast.TemplateLiteral, got=%T", stmt.Expression)
+	}
+
+	expectedStrings := []string{"sum: ", ", ", "!"}
+	if len(template.Strings) != len(expectedStrings) {
+		t.Fatalf("template.Strings has wrong length, got=%q", template.Strings)
+	}
+	for i, str := range expectedStrings {
+		if template.Strings[i] != str {
+			t.Errorf("template.Strings[%d] is not %q, got=%q", i, str, template.Strings[i])
+		}
+	}
+
+	if len(template.Expressions) != 2 {
+		t.Fatalf("template.Expressions has wrong length, got=%d", len(template.Expressions))
+	}
+	testInfixLiteral(t, template.Expressions[0], "a", "+", "b")
+
+	nested, ok := template.Expressions[1].(*ast.TemplateLiteral)
+	if !ok {
+		t.Fatalf("template.Expressions[1] is not a *ast.TemplateLiteral, got=%T", template.Expressions[1])
+	}
+	if nested.String() != "nested ${c}" {
+		t.Errorf("nested.String() wrong, got=%q", nested.String())
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	input := `
 		false;
@@ -369,6 +446,11 @@ func TestInfixExpression(t *testing.T) {
 		{"4 < 7", 4, "<", 7},
 		{"4 == 7", 4, "==", 7},
 		{"4 != 7", 4, "!=", 7},
+		{"4 % 7", 4, "%", 7},
+		{"4 <= 7", 4, "<=", 7},
+		{"4 >= 7", 4, ">=", 7},
+		{"true && false", true, "&&", false},
+		{"bob || joe", "bob", "||", "joe"},
 		{"bob != joe", "bob", "!=", "joe"},
 		{"something + anotherVar", "something", "+", "anotherVar"},
 		{"true != false", true, "!=", false},
@@ -559,6 +641,42 @@ func TestPrecedenceParsing(t *testing.T) {
 			"add(a * b[3], b[1], 2 * [2, 4][0])",
 			"add((a * (b[3])), (b[1]), (2 * ([2, 4][0])))",
 		},
+		{
+			"x = y + 1",
+			"(x = (y + 1))",
+		},
+		{
+			"x = y = z",
+			"(x = (y = z))",
+		},
+		{
+			"x += a * b == c",
+			"(x += ((a * b) == c))",
+		},
+		{
+			"a[i + 1] *= f(x)",
+			"((a[(i + 1)]) *= f(x))",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c || d",
+			"((a || (b && c)) || d)",
+		},
+		{
+			"a == b && c != d || !e",
+			"(((a == b) && (c != d)) || (!e))",
+		},
+		{
+			"x %= a < b || c",
+			"(x %= ((a < b) || c))",
+		},
 	}
 
 	for _, test := range tests {
@@ -947,29 +1065,40 @@ func TestHashLiteralParsing(t *testing.T) {
 		op    string
 		right int64
 	}
-	expected := map[string]interface{}{
-		"key1":       infixExpected{4, "+", 4},
-		"anotherOne": 7,
-		"bool":       true,
+	expected := []struct {
+		key   string
+		value interface{}
+	}{
+		{"key1", infixExpected{4, "+", 4}},
+		{"anotherOne", 7},
+		{"bool", true},
 	}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not *ast.StringLiteral, got=%T", key)
+			t.Errorf("key is not *ast.StringLiteral, got=%T", pair.Key)
+			continue
 		}
 
-		expectedVal := expected[literal.String()]
+		if literal.String() != expected[i].key {
+			t.Errorf("key [%d] is out of order. wanted=%q, got=%q", i, expected[i].key, literal.String())
+		}
 
-		switch ev := expectedVal.(type) {
+		switch ev := expected[i].value.(type) {
 		case int:
-			testIntegerLiteral(t, value, int64(ev))
+			testIntegerLiteral(t, pair.Value, int64(ev))
 		case bool:
-			testBooleanLiteral(t, value, bool(ev))
+			testBooleanLiteral(t, pair.Value, bool(ev))
 		case infixExpected:
-			testInfixLiteral(t, value, ev.left, ev.op, ev.right)
+			testInfixLiteral(t, pair.Value, ev.left, ev.op, ev.right)
 		}
 	}
+
+	expectedString := `{key1:(4 + 4), anotherOne:7, bool:true}`
+	if hash.String() != expectedString {
+		t.Errorf("hash.String() wrong. wanted=%q, got=%q", expectedString, hash.String())
+	}
 }
 
 func TestEmptyHashLiteralParsing(t *testing.T) {
@@ -991,3 +1120,334 @@ func TestEmptyHashLiteralParsing(t *testing.T) {
 		t.Fatalf("length of hash pairs is wrong. wanted=0, got=%d", len(hash.Pairs))
 	}
 }
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 4;", "1:5: expected '=' to be IDENT, got = instead"},
+		{"let x = 4;\nlet y 4;", "2:7: expected '4' to be =, got INT instead"},
+		{"\n\n  ;", "3:3: no prefix parsing fn for ; found"},
+		{"let s = \"abc;", "1:9: unterminated string"},
+		{"let x = 1; /* no end", "1:12: unterminated comment"},
+		{"add(1, /* no end", "1:8: unterminated comment"},
+		{"let s = \"a\\qb\";", "1:11: invalid escape sequence \\q in string"},
+		{"let s = \"\\u{110000}\";", "1:10: invalid escape sequence \\u{110000} in string"},
+		{"let s = `raw", "1:9: unterminated string"},
+		{"let s = \"a ${}\";", "1:14: missing expression in ${} of string"},
+		{"let s = \"a ${b c}\";", "1:16: expected 'c' to be }, got IDENT instead"},
+		{"let s = \"a ${b\";", "1:15: expected ';' to be }, got UNTERMINATED_STRING instead"},
+		{"let s = \"${\"\\q\"} ${b}\";", "1:13: invalid escape sequence \\q in string"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q, got none", test.input)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("parser error wrong. expected=%q, got=%q", test.expected, errors[0])
+		}
+	}
+}
+
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := `let myFunction = fn() { };`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not a *ast.LetStatement, got=%T",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not a *ast.FunctionLiteral, got=%T", stmt.Value)
+	}
+
+	if function.Name != "myFunction" {
+		t.Errorf("function.Name is not 'myFunction', got=%q", function.Name)
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { x; break; continue; }`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected program to have 1 statement, got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not a *ast.WhileStatement, got=%T",
+			program.Statements[0])
+	}
+
+	if !testInfixLiteral(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body does not have 3 statements, got=%d", len(stmt.Body.Statements))
+	}
+
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("stmt.Body.Statements[1] is not a *ast.BreakStatement, got=%T",
+			stmt.Body.Statements[1])
+	}
+
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("stmt.Body.Statements[2] is not a *ast.ContinueStatement, got=%T",
+			stmt.Body.Statements[2])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"for (let i = 0; i < 10; let i = i + 1) { i }",
+			"for (let i = 0; (i < 10); let i = (i + 1)) i",
+		},
+		{
+			"for (; i < 10; ) { i }",
+			"for (; (i < 10); ) i",
+		},
+		{
+			"for (;;) { break }",
+			"for (; ; ) break;",
+		},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("expected program to have 1 statement, got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not a *ast.ForStatement, got=%T",
+				program.Statements[0])
+		}
+
+		if stmt.String() != test.expected {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", test.expected, stmt.String())
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of a loop"},
+		{"if (true) { continue }", "1:13: continue outside of a loop"},
+		{"while (true) { fn() { break } }", "1:23: break outside of a loop"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 parser error for %q, got=%d (%v)", test.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("parser error wrong. expected=%q, got=%q", test.expected, errors[0])
+		}
+	}
+}
+
+func TestLoopTrailingSemicolon(t *testing.T) {
+	input := "while (x) { x }; for (;;) { break };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+		target   string
+		value    interface{}
+	}{
+		{"x = 4;", "=", "x", 4},
+		{"x += 4;", "+=", "x", 4},
+		{"x -= y;", "-=", "x", "y"},
+		{"x *= true;", "*=", "x", true},
+		{"x /= 2;", "/=", "x", 2},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("expected program to have 1 statement, got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not a *ast.ExpressionStatement, got=%T",
+				program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not a *ast.AssignExpression, got=%T",
+				stmt.Expression)
+		}
+
+		if exp.Operator != test.operator {
+			t.Fatalf("exp.Operator is not '%s', got=\"%s\"", test.operator, exp.Operator)
+		}
+
+		if !testIdentifierLiteral(t, exp.Target, test.target) {
+			return
+		}
+
+		if !testLiteralExpression(t, exp.Value, test.value) {
+			return
+		}
+	}
+}
+
+func TestUpdateExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x++", "(x++)"},
+		{"x--", "(x--)"},
+		{"++x", "(++x)"},
+		{"--x", "(--x)"},
+		{"a[i + 1]++", "((a[(i + 1)])++)"},
+		{"++a[0][1]", "(++((a[0])[1]))"},
+		{"-x++", "(-(x++))"},
+		{"!++x", "(!(++x))"},
+		{"x++ * 2", "((x++) * 2)"},
+		{"a - --b", "(a - (--b))"},
+		{"y = x++", "(y = (x++))"},
+		// on the next line ++ starts the next statement instead
+		{"x\n++y", "x(++y)"},
+		{"x ++\ny", "(x++)y"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != test.expected {
+			t.Errorf("program.String() wrong for %q. expected=%q, got=%q", test.input, test.expected, program.String())
+		}
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"4 = x", "1:3: cannot assign to 4"},
+		{"f() += 1", "1:5: cannot assign to f()"},
+		{"a + b = c", "1:7: cannot assign to (a + b)"},
+		{"4++", "1:2: cannot apply ++ to 4"},
+		{"f()--", "1:4: cannot apply -- to f()"},
+		{"++-x", "1:1: cannot apply ++ to (-x)"},
+		{"--(a + b)", "1:1: cannot apply -- to (a + b)"},
+		{"x++++", "1:4: cannot apply ++ to (x++)"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q, got none", test.input)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("parser error wrong. expected=%q, got=%q", test.expected, errors[0])
+		}
+	}
+}
+
+func TestImportExpression(t *testing.T) {
+	input := `let lib = import "lib/math.amoeba";`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not a *ast.LetStatement, got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Value.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("stmt.Value is not a *ast.ImportExpression, got=%T", stmt.Value)
+	}
+
+	if exp.Path != "lib/math.amoeba" {
+		t.Errorf("exp.Path is not %q, got=%q", "lib/math.amoeba", exp.Path)
+	}
+
+	if exp.String() != `import "lib/math.amoeba"` {
+		t.Errorf("exp.String() wrong, got=%q", exp.String())
+	}
+}
@@ -0,0 +1,160 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+	"github.com/ASteinheiser/amoeba-interpreter/token"
+)
+
+// command is a REPL meta-command, typed as its name after a colon
+type command struct {
+	name string
+	args string // what the argument is, empty when there isn't one
+	help string
+	run  func(s *session, arg string, out io.Writer)
+}
+
+// commands is filled in by init, since :help needs to list them
+var commands []command
+
+func init() {
+	commands = []command{
+		{"help", "", "show this list of commands", helpCommand},
+		{"env", "", "list the names defined in the session", envCommand},
+		{"type", "expr", "evaluate an expression and show the type of its value", typeCommand},
+		{"load", "file", "evaluate a file into the session", loadCommand},
+		{"reset", "", "forget everything defined in the session", resetCommand},
+		{"ast", "code", "show how code is parsed", astCommand},
+		{"tokens", "code", "show the tokens code is lexed into", tokensCommand},
+	}
+}
+
+// runCommand runs a line starting with a colon as a meta-command
+func runCommand(s *session, line string, out io.Writer) {
+	name, arg := line[1:], ""
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i:])
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		if cmd.args != "" && arg == "" {
+			fmt.Fprintf(out, "usage: :%s <%s>\n", cmd.name, cmd.args)
+			return
+		}
+		cmd.run(s, arg, out)
+		return
+	}
+
+	fmt.Fprintf(out, "Unknown command :%s, type :help to see the commands\n", name)
+}
+
+func helpCommand(s *session, arg string, out io.Writer) {
+	for _, cmd := range commands {
+		usage := ":" + cmd.name
+		if cmd.args != "" {
+			usage += " <" + cmd.args + ">"
+		}
+		fmt.Fprintf(out, "  %-16s %s\n", usage, cmd.help)
+	}
+	fmt.Fprintf(out, "  %-16s %s\n", "exit, quit", "leave the REPL")
+}
+
+func envCommand(s *session, arg string, out io.Writer) {
+	names := s.env.Names()
+	if len(names) == 0 {
+		io.WriteString(out, "Nothing is defined yet\n")
+		return
+	}
+
+	for _, name := range names {
+		val, _ := s.env.Get(name)
+
+		// functions print their whole body, which is too much for a listing
+		switch val.(type) {
+		case *object.Function, *object.Closure, *object.Builtin:
+			fmt.Fprintf(out, "  %s: %s\n", name, val.Type())
+		default:
+			fmt.Fprintf(out, "  %s: %s = %s\n", name, val.Type(), object.Pretty(val, 0))
+		}
+	}
+}
+
+func typeCommand(s *session, arg string, out io.Writer) {
+	program, ok := parse(lexer.New(arg), out)
+	if !ok {
+		return
+	}
+	if printDiagnostics(out, s.names.Resolve(program)) {
+		return
+	}
+
+	switch val := s.env.Run(program).(type) {
+	case nil:
+		io.WriteString(out, "no value\n")
+	case *object.Error:
+		io.WriteString(out, val.Inspect()+"\n")
+	default:
+		io.WriteString(out, string(val.Type())+"\n")
+	}
+}
+
+func loadCommand(s *session, arg string, out io.Writer) {
+	data, err := ioutil.ReadFile(arg)
+	if err != nil {
+		fmt.Fprintln(out, "File reading error:", err)
+		return
+	}
+
+	evaluateProgram(lexer.NewWithFilename(string(data), arg), out, s.env, s.names)
+}
+
+func resetCommand(s *session, arg string, out io.Writer) {
+	if err := s.reset(); err != nil {
+		fmt.Fprintln(out, err)
+		return
+	}
+	io.WriteString(out, "Session cleared\n")
+}
+
+func astCommand(s *session, arg string, out io.Writer) {
+	program, ok := parse(lexer.New(arg), out)
+	if !ok {
+		return
+	}
+
+	for _, stmt := range program.Statements {
+		fmt.Fprintf(out, "  %T %s\n", stmt, stmt.String())
+	}
+}
+
+func tokensCommand(s *session, arg string, out io.Writer) {
+	l := lexer.New(arg)
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(out, "  %-6s %-20s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+}
+
+// parse parses a program, printing its errors when there are any
+func parse(l *lexer.Lexer, out io.Writer) (*ast.Program, bool) {
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return nil, false
+	}
+
+	return program, true
+}
@@ -0,0 +1,70 @@
+package repl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+)
+
+func testCommands(t *testing.T, engineName string, lines ...string) string {
+	s, err := newSession(engineName, evaluator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	for _, line := range lines {
+		if line[0] == ':' {
+			runCommand(s, line, &out)
+		} else {
+			evaluateProgram(lexer.New(line), &out, s.env, s.names)
+		}
+	}
+	return out.String()
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		lines    []string
+		expected string
+	}{
+		{
+			[]string{"let f = fn(x) { x };", "let a = [1, 2];", ":env"},
+			"  a: ARRAY = [1, 2]\n  f: FUNCTION\n",
+		},
+		{[]string{":env"}, "Nothing is defined yet\n"},
+		{[]string{`let name = "amoeba";`, ":env"}, "  name: STRING = \"amoeba\"\n"},
+		{[]string{`["a", {"b": "c\td"}]`}, "\n[\"a\", {\"b\": \"c\\td\"}]\n\n"},
+		{[]string{"let n = 1;", ":type n + 0.5"}, "FLOAT\n"},
+		{[]string{"fn(x, y) { let z = x + y; z * 2 }"}, "\nfn(x, y) {\n  let z = x + y;\n  z * 2\n}\n\n"},
+		{[]string{":type \"a\" + 1"}, "ERROR: 1:5: type mismatch: STRING + INTEGER\n"},
+		{[]string{":type let x = 1;"}, "no value\n"},
+		{[]string{":type"}, "usage: :type <expr>\n"},
+		{[]string{"let n = 1;", ":reset", ":env"}, "Session cleared\nNothing is defined yet\n"},
+		{
+			[]string{":load ../evaluator/testdata/math.amoeba", ":type square"},
+			"FUNCTION\n",
+		},
+		{[]string{":load missing.amoeba"}, "File reading error: open missing.amoeba: no such file or directory\n"},
+		{
+			[]string{":ast let x = 1 + 2 * 3;"},
+			"  *ast.LetStatement let x = (1 + (2 * 3));\n",
+		},
+		{
+			[]string{":tokens x += 1"},
+			"  1:1    IDENT                \"x\"\n  1:3    +=                   \"+=\"\n  1:6    INT                  \"1\"\n",
+		},
+		{[]string{":nope"}, "Unknown command :nope, type :help to see the commands\n"},
+	}
+
+	for _, engineName := range []string{"eval", "vm"} {
+		for _, test := range tests {
+			output := testCommands(t, engineName, test.lines...)
+			if output != test.expected {
+				t.Errorf("[%s] %q wrong. expected=%q, got=%q", engineName, test.lines, test.expected, output)
+			}
+		}
+	}
+}
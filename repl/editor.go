@@ -0,0 +1,667 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when ctrl-c abandons the line
+var ErrInterrupted = errors.New("interrupted")
+
+// MaxHistory is the number of lines of history that are kept
+const MaxHistory = 1000
+
+// keys read from the terminal, control keys are their ascii codes and
+// escape sequences are decoded to negative values that no rune uses
+const (
+	keyCtrlA     rune = 1
+	keyCtrlB     rune = 2
+	keyCtrlC     rune = 3
+	keyCtrlD     rune = 4
+	keyCtrlE     rune = 5
+	keyCtrlF     rune = 6
+	keyCtrlG     rune = 7
+	keyCtrlH     rune = 8
+	keyTab       rune = 9
+	keyLineFeed  rune = 10
+	keyCtrlK     rune = 11
+	keyCtrlL     rune = 12
+	keyEnter     rune = 13
+	keyCtrlN     rune = 14
+	keyCtrlP     rune = 16
+	keyCtrlR     rune = 18
+	keyCtrlU     rune = 21
+	keyCtrlW     rune = 23
+	keyEscape    rune = 27
+	keyBackspace rune = 127
+
+	keyUp rune = -1 - iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+// Editor reads lines typed into a terminal, with cursor movement,
+// history that can be kept in a file, reverse search and tab completion.
+// When its input isn't a terminal it reads lines without any editing
+type Editor struct {
+	in  *bufio.Reader
+	fd  uintptr
+	tty bool
+	out io.Writer
+
+	// Complete returns the words that could finish the word before the
+	// cursor when tab is pressed, it is optional
+	Complete func(word string) []string
+
+	history     []string
+	historyPath string
+
+	// the line being read
+	buf         []rune
+	pos         int
+	prompt      func()
+	promptWidth int
+	browsing    int    // index of the history entry shown, len(history) for the new line
+	edited      []rune // the new line, kept while browsing history
+
+	// where the line was last drawn, in rows below the prompt's
+	cursorRow int
+	endRow    int
+	width     int // the terminal's columns, looked up when 0
+}
+
+// NewEditor creates an Editor that reads keys from in and draws to out
+func NewEditor(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{in: bufio.NewReader(in), out: out}
+
+	if f, ok := in.(*os.File); ok && isTerminal(f.Fd()) {
+		e.fd = f.Fd()
+		e.tty = true
+	}
+
+	return e
+}
+
+// Interactive reports whether lines are being typed into a terminal
+func (e *Editor) Interactive() bool { return e.tty }
+
+// LoadHistory reads the history kept in the file at path, which every
+// line read afterwards is added to. A missing file is left to be created
+func (e *Editor) LoadHistory(path string) error {
+	e.historyPath = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+
+	// the file only ever gets appended to, so trim it back down here
+	if len(e.history) > MaxHistory {
+		e.history = e.history[len(e.history)-MaxHistory:]
+		return ioutil.WriteFile(path, []byte(strings.Join(e.history, "\n")+"\n"), 0600)
+	}
+
+	return nil
+}
+
+// History returns the lines read so far, oldest first
+func (e *Editor) History() []string { return e.history }
+
+func (e *Editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > MaxHistory {
+		e.history = e.history[1:]
+	}
+
+	if e.historyPath == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// ReadLine shows a prompt, drawn by the prompt function and taking up
+// promptWidth columns, and reads a line. It returns io.EOF once input
+// runs out or ctrl-d is pressed on an empty line, and ErrInterrupted
+// when ctrl-c is pressed
+func (e *Editor) ReadLine(prompt func(), promptWidth int) (string, error) {
+	if !e.tty {
+		prompt()
+		return e.readPlainLine()
+	}
+
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	return e.edit(prompt, promptWidth)
+}
+
+func (e *Editor) readPlainLine() (string, error) {
+	line, err := e.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+	e.addHistory(line)
+	return line, nil
+}
+
+// edit reads keys until the line is finished, redrawing it after each
+func (e *Editor) edit(prompt func(), promptWidth int) (string, error) {
+	e.buf, e.pos = nil, 0
+	e.prompt, e.promptWidth = prompt, promptWidth
+	e.browsing, e.edited = len(e.history), nil
+	e.cursorRow, e.endRow = 0, 0
+
+	prompt()
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		if key == keyCtrlR {
+			e.clearLine()
+			key = e.search()
+			e.refresh()
+			if key == 0 {
+				continue
+			}
+		}
+
+		switch key {
+		case keyEnter, keyLineFeed:
+			e.leaveLine()
+			line := string(e.buf)
+			e.addHistory(line)
+			return line, nil
+
+		case keyCtrlC:
+			io.WriteString(e.out, "^C")
+			e.leaveLine()
+			return "", ErrInterrupted
+
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				e.leaveLine()
+				return "", io.EOF
+			}
+			e.delete(e.pos)
+
+		case keyCtrlA, keyHome:
+			e.pos = 0
+
+		case keyCtrlE, keyEnd:
+			e.pos = len(e.buf)
+
+		case keyCtrlB, keyLeft:
+			if e.pos > 0 {
+				e.pos--
+			}
+
+		case keyCtrlF, keyRight:
+			if e.pos < len(e.buf) {
+				e.pos++
+			}
+
+		case keyBackspace, keyCtrlH:
+			if e.pos > 0 {
+				e.pos--
+				e.delete(e.pos)
+			}
+
+		case keyDelete:
+			e.delete(e.pos)
+
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+
+		case keyCtrlU:
+			e.buf = append([]rune{}, e.buf[e.pos:]...)
+			e.pos = 0
+
+		case keyCtrlW:
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+
+		case keyCtrlP, keyUp:
+			e.browse(e.browsing - 1)
+
+		case keyCtrlN, keyDown:
+			e.browse(e.browsing + 1)
+
+		case keyTab:
+			e.complete()
+
+		case keyCtrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+			e.cursorRow, e.endRow = 0, 0
+			e.prompt()
+
+		default:
+			if key >= ' ' && unicode.IsPrint(key) {
+				e.insert([]rune{key})
+			}
+		}
+
+		e.refresh()
+	}
+}
+
+// refresh redraws the line after the prompt and moves the cursor to
+// where it is in the line. A line too long for the terminal carries on
+// over the rows below, which are cleared of what was there before
+func (e *Editor) refresh() {
+	width := e.columns()
+
+	if e.cursorRow > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dA", e.cursorRow)
+	}
+	fmt.Fprintf(e.out, "\x1b[%dG%s\x1b[J", e.promptWidth+1, string(e.buf))
+
+	// a line that ends in the last column leaves the cursor there
+	// until something else is written, so move it on to the next row
+	endRow, endCol := e.locate(e.buf, width)
+	if endCol == width {
+		io.WriteString(e.out, "\r\n")
+		endRow++
+	}
+
+	row, col := e.locate(e.buf[:e.pos], width)
+	if col == width {
+		row, col = row+1, 0
+	}
+	if endRow > row {
+		fmt.Fprintf(e.out, "\x1b[%dA", endRow-row)
+	}
+	fmt.Fprintf(e.out, "\x1b[%dG", col+1)
+
+	e.cursorRow, e.endRow = row, endRow
+}
+
+// locate returns the row below the prompt's and the column that
+// writing runes after the prompt leaves the cursor at. A wide character
+// that doesn't fit at the end of a row goes at the start of the next
+func (e *Editor) locate(runes []rune, width int) (row, col int) {
+	col = e.promptWidth
+	for _, r := range runes {
+		w := runeWidth(r)
+		if col+w > width {
+			row, col = row+1, 0
+		}
+		col += w
+	}
+	return row, col
+}
+
+// columns returns how wide the terminal is, lines are never
+// wrapped when that isn't known
+func (e *Editor) columns() int {
+	width := e.width
+	if width == 0 && e.tty {
+		width = terminalWidth(e.fd)
+	}
+	if width <= e.promptWidth {
+		return math.MaxInt32
+	}
+	return width
+}
+
+// clearLine moves back to the row of the prompt and clears the line
+// from there, for something else to be drawn in its place
+func (e *Editor) clearLine() {
+	if e.cursorRow > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dA", e.cursorRow)
+	}
+	io.WriteString(e.out, "\r\x1b[J")
+	e.cursorRow, e.endRow = 0, 0
+}
+
+// leaveLine moves to the start of the row after the line, so that
+// what comes next doesn't write over the rows it wrapped onto
+func (e *Editor) leaveLine() {
+	if e.endRow > e.cursorRow {
+		fmt.Fprintf(e.out, "\x1b[%dB", e.endRow-e.cursorRow)
+	}
+	io.WriteString(e.out, "\r\n")
+	e.cursorRow, e.endRow = 0, 0
+}
+
+// runeWidth returns the number of columns a terminal shows r in: none
+// for combining marks, two for wide characters like CJK ideographs and
+// emoji, and one for everything else
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, wide := range wideRanges {
+		if r < wide.lo {
+			break
+		}
+		if r <= wide.hi {
+			return 2
+		}
+	}
+	return 1
+}
+
+// wideRanges are the blocks of characters shown two columns wide,
+// in order, taken from Unicode's East Asian Width property
+var wideRanges = []struct{ lo, hi rune }{
+	{0x1100, 0x115F},   // Hangul Jamo
+	{0x231A, 0x231B},   // watch, hourglass
+	{0x2329, 0x232A},   // angle brackets
+	{0x23E9, 0x23EC},   // media controls
+	{0x23F0, 0x23F0},   // alarm clock
+	{0x23F3, 0x23F3},   // hourglass
+	{0x25FD, 0x25FE},   // small squares
+	{0x2614, 0x2615},   // umbrella, hot beverage
+	{0x2648, 0x2653},   // zodiac
+	{0x267F, 0x267F},   // wheelchair
+	{0x2693, 0x2693},   // anchor
+	{0x26A1, 0x26A1},   // high voltage
+	{0x26AA, 0x26AB},   // circles
+	{0x26BD, 0x26BE},   // balls
+	{0x26C4, 0x26C5},   // snowman, sun
+	{0x26CE, 0x26CE},   // ophiuchus
+	{0x26D4, 0x26D4},   // no entry
+	{0x26EA, 0x26EA},   // church
+	{0x26F2, 0x26F3},   // fountain, golf
+	{0x26F5, 0x26F5},   // sailboat
+	{0x26FA, 0x26FA},   // tent
+	{0x26FD, 0x26FD},   // fuel pump
+	{0x2705, 0x2705},   // check mark
+	{0x270A, 0x270B},   // fists
+	{0x2728, 0x2728},   // sparkles
+	{0x274C, 0x274C},   // cross mark
+	{0x274E, 0x274E},   // cross mark
+	{0x2753, 0x2755},   // question marks
+	{0x2757, 0x2757},   // exclamation mark
+	{0x2795, 0x2797},   // plus, minus, divide
+	{0x27B0, 0x27B0},   // curly loop
+	{0x27BF, 0x27BF},   // double curly loop
+	{0x2B1B, 0x2B1C},   // large squares
+	{0x2B50, 0x2B50},   // star
+	{0x2B55, 0x2B55},   // circle
+	{0x2E80, 0x303E},   // CJK radicals and punctuation
+	{0x3041, 0x33FF},   // kana, bopomofo, CJK compatibility
+	{0x3400, 0x4DBF},   // CJK extension A
+	{0x4E00, 0x9FFF},   // CJK unified ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xA960, 0xA97F},   // Hangul Jamo extended A
+	{0xAC00, 0xD7A3},   // Hangul syllables
+	{0xF900, 0xFAFF},   // CJK compatibility ideographs
+	{0xFE10, 0xFE19},   // vertical forms
+	{0xFE30, 0xFE6F},   // CJK compatibility forms, small forms
+	{0xFF00, 0xFF60},   // fullwidth forms
+	{0xFFE0, 0xFFE6},   // fullwidth signs
+	{0x16FE0, 0x16FE4}, // ideographic symbols
+	{0x17000, 0x18AFF}, // Tangut
+	{0x1B000, 0x1B2FF}, // kana supplement and extended
+	{0x1F004, 0x1F004}, // mahjong tile
+	{0x1F0CF, 0x1F0CF}, // playing card
+	{0x1F18E, 0x1F18E}, // AB button
+	{0x1F191, 0x1F19A}, // squared words
+	{0x1F200, 0x1F251}, // enclosed ideographs
+	{0x1F300, 0x1F64F}, // pictographs and emoticons
+	{0x1F680, 0x1F6FF}, // transport and map symbols
+	{0x1F7E0, 0x1F7EB}, // coloured circles and squares
+	{0x1F90C, 0x1F9FF}, // supplemental symbols and pictographs
+	{0x1FA70, 0x1FAFF}, // symbols and pictographs extended A
+	{0x20000, 0x2FFFD}, // CJK extensions B to F
+	{0x30000, 0x3FFFD}, // CJK extension G
+}
+
+func (e *Editor) insert(runes []rune) {
+	buf := make([]rune, 0, len(e.buf)+len(runes))
+	buf = append(buf, e.buf[:e.pos]...)
+	buf = append(buf, runes...)
+	e.buf = append(buf, e.buf[e.pos:]...)
+	e.pos += len(runes)
+}
+
+func (e *Editor) delete(pos int) {
+	if pos < len(e.buf) {
+		e.buf = append(e.buf[:pos], e.buf[pos+1:]...)
+	}
+}
+
+// browse shows entry i of the history, or the line that was being
+// typed before browsing started once i goes past the newest entry
+func (e *Editor) browse(i int) {
+	if i < 0 || i > len(e.history) || i == e.browsing {
+		return
+	}
+
+	if e.browsing == len(e.history) {
+		e.edited = e.buf
+	}
+	e.browsing = i
+
+	if i == len(e.history) {
+		e.buf = e.edited
+	} else {
+		e.buf = []rune(e.history[i])
+	}
+	e.pos = len(e.buf)
+}
+
+// search runs a reverse incremental search of the history, started by
+// ctrl-r. Typing narrows the search and ctrl-r again finds an older
+// match. Ctrl-g or ctrl-c cancel it, returning 0, any other key puts
+// the match in the line and is returned to be handled as usual
+func (e *Editor) search() rune {
+	var query []rune
+	match := len(e.history)
+	failing := false
+
+	// find keeps the last match when nothing older matches, like bash
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				match = i
+				failing = false
+				return
+			}
+		}
+		failing = true
+	}
+
+	for {
+		found := ""
+		if match < len(e.history) {
+			found = e.history[match]
+		}
+		label := "reverse-i-search"
+		if failing {
+			label = "failing " + label
+		}
+		fmt.Fprintf(e.out, "\r\x1b[K(%s)`%s': %s", label, string(query), found)
+
+		key, err := e.readKey()
+		if err != nil {
+			key = keyCtrlG
+		}
+
+		switch {
+		case key == keyCtrlR:
+			find(match - 1)
+
+		case key == keyBackspace || key == keyCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(e.history) - 1)
+			}
+
+		case key == keyCtrlG || key == keyCtrlC:
+			io.WriteString(e.out, "\r\x1b[K")
+			e.prompt()
+			return 0
+
+		case key >= ' ' && unicode.IsPrint(key):
+			query = append(query, key)
+			from := match
+			if from == len(e.history) {
+				from--
+			}
+			find(from)
+
+		default:
+			if found != "" {
+				e.buf = []rune(found)
+				e.pos = len(e.buf)
+				e.browsing = len(e.history)
+			}
+			io.WriteString(e.out, "\r\x1b[K")
+			e.prompt()
+			return key
+		}
+	}
+}
+
+// complete finishes the word before the cursor as far as every candidate
+// agrees, listing the candidates when that doesn't add anything
+func (e *Editor) complete() {
+	if e.Complete == nil {
+		return
+	}
+
+	start := e.pos
+	for start > 0 && isWordRune(e.buf[start-1]) {
+		start--
+	}
+	word := string(e.buf[start:e.pos])
+	if word == "" {
+		return
+	}
+
+	candidates := e.Complete(word)
+	if len(candidates) == 0 {
+		io.WriteString(e.out, "\a")
+		return
+	}
+
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	if len(prefix) > len(word) {
+		e.insert([]rune(prefix[len(word):]))
+		return
+	}
+
+	if len(candidates) > 1 {
+		e.leaveLine()
+		io.WriteString(e.out, strings.Join(candidates, "  ")+"\r\n")
+		e.prompt()
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// readKey reads a single key, decoding the escape sequences sent by
+// arrow keys and the like. Terminals send a sequence all at once, so an
+// escape with nothing read in after it is the escape key on its own
+func (e *Editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape || e.in.Buffered() == 0 {
+		return r, err
+	}
+
+	next, _, err := e.in.ReadRune()
+	if err != nil {
+		return keyUnknown, err
+	}
+	if next != '[' && next != 'O' {
+		return keyUnknown, nil
+	}
+
+	// the sequence is parameters then a final character, like [A or [3~
+	var params []rune
+	for {
+		c, _, err := e.in.ReadRune()
+		if err != nil {
+			return keyUnknown, err
+		}
+		if c >= 0x40 && c <= 0x7e {
+			return decodeEscape(string(params), c), nil
+		}
+		params = append(params, c)
+	}
+}
+
+func decodeEscape(params string, final rune) rune {
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		return keyRight
+	case 'D':
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyDelete
+		}
+	}
+	return keyUnknown
+}
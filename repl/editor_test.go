@@ -0,0 +1,243 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testEditor(keys string, history ...string) *Editor {
+	e := NewEditor(strings.NewReader(keys), &bytes.Buffer{})
+	e.history = history
+	return e
+}
+
+func TestEditorKeys(t *testing.T) {
+	tests := []struct {
+		keys     string
+		history  []string
+		expected string
+	}{
+		{"let x = 5;\r", nil, "let x = 5;"},
+		{"abc\x7f\x7fd\r", nil, "ad"},
+		{"bc\x01a\x05d\r", nil, "abcd"},
+		{"ac\x1b[Db\r", nil, "abc"},
+		{"abc\x1b[D\x1b[D\x1b[3~\r", nil, "ac"},
+		{"abcdef\x1b[D\x1b[D\x0b\r", nil, "abcd"},
+		{"abcdef\x1b[D\x1b[D\x15\r", nil, "ef"},
+		{"let foo bar\x17\r", nil, "let foo "},
+		{"x\x1b[H\x1b[C\x1b[F!\r", nil, "x!"},
+		{"\x1b[A\r", []string{"first", "second"}, "second"},
+		{"\x1b[A\x1b[A\r", []string{"first", "second"}, "first"},
+		{"\x10\x10\x10\x0e\r", []string{"first", "second"}, "second"},
+		{"new\x1b[A\x1b[B\r", []string{"first"}, "new"},
+		{"\x1b[A!\r", []string{"first"}, "first!"},
+		{"\x12fi\r", []string{"first", "second", "third"}, "first"},
+		{"\x12d\x12\r", []string{"old", "second", "third"}, "second"},
+		{"\x12sec\x1b[D!\r", []string{"first", "second"}, "secon!d"},
+		{"typed\x12sec\x07\r", []string{"second"}, "typed"},
+		{"h\x12zzz\x05\r", []string{"first"}, "h"},
+	}
+
+	for _, test := range tests {
+		e := testEditor(test.keys, test.history...)
+
+		line, err := e.edit(func() {}, 0)
+		if err != nil {
+			t.Errorf("keys %q returned error: %s", test.keys, err)
+			continue
+		}
+		if line != test.expected {
+			t.Errorf("keys %q wrong. expected=%q, got=%q", test.keys, test.expected, line)
+		}
+	}
+}
+
+func TestEditorInterruptAndEOF(t *testing.T) {
+	e := testEditor("abc\x03\x04")
+
+	if _, err := e.edit(func() {}, 0); err != ErrInterrupted {
+		t.Errorf("ctrl-c wrong. expected=%v, got=%v", ErrInterrupted, err)
+	}
+	if _, err := e.edit(func() {}, 0); err != io.EOF {
+		t.Errorf("ctrl-d wrong. expected=%v, got=%v", io.EOF, err)
+	}
+	if _, err := e.edit(func() {}, 0); err != io.EOF {
+		t.Errorf("end of input wrong. expected=%v, got=%v", io.EOF, err)
+	}
+}
+
+func TestEditorBareEscape(t *testing.T) {
+	in, keys := io.Pipe()
+	e := NewEditor(in, &bytes.Buffer{})
+
+	// the c is only typed once the escape has been read, so it
+	// mustn't be taken as the rest of an escape sequence
+	go func() {
+		keys.Write([]byte("ab\x1b"))
+		keys.Write([]byte("c\r"))
+	}()
+
+	line, err := e.edit(func() {}, 0)
+	if err != nil {
+		t.Fatalf("edit returned error: %s", err)
+	}
+	if line != "abc" {
+		t.Errorf("line wrong. expected=%q, got=%q", "abc", line)
+	}
+}
+
+func TestEditorRefreshWraps(t *testing.T) {
+	tests := []struct {
+		width     int
+		line      string
+		pos       int
+		cursorRow int
+		expected  string
+		row       int
+	}{
+		{10, "abcdefghijkl", 12, 0, "\x1b[3Gabcdefghijkl\x1b[J\x1b[5G", 1},
+		{10, "abcdefghijkl", 4, 1, "\x1b[1A\x1b[3Gabcdefghijkl\x1b[J\x1b[1A\x1b[7G", 0},
+		// ending in the last column moves on to the next row
+		{5, "abc", 3, 0, "\x1b[3Gabc\x1b[J\r\n\x1b[1G", 1},
+		// a wide character that doesn't fit goes on the next row
+		{5, "你好", 2, 0, "\x1b[3G你好\x1b[J\x1b[3G", 1},
+		{5, "你好", 1, 0, "\x1b[3G你好\x1b[J\x1b[1A\x1b[5G", 0},
+		{0, "abcdefghijkl", 1, 0, "\x1b[3Gabcdefghijkl\x1b[J\x1b[4G", 0},
+	}
+
+	for _, test := range tests {
+		out := &bytes.Buffer{}
+		e := NewEditor(strings.NewReader(""), out)
+		e.width, e.promptWidth = test.width, 2
+		e.buf, e.pos, e.cursorRow = []rune(test.line), test.pos, test.cursorRow
+
+		e.refresh()
+		if out.String() != test.expected {
+			t.Errorf("%q at %d drawn wrong. expected=%q, got=%q", test.line, test.pos, test.expected, out.String())
+		}
+		if e.cursorRow != test.row {
+			t.Errorf("%q at %d left on the wrong row. expected=%d, got=%d", test.line, test.pos, test.row, e.cursorRow)
+		}
+	}
+}
+
+func TestRuneWidth(t *testing.T) {
+	tests := []struct {
+		r        rune
+		expected int
+	}{
+		{'a', 1},
+		{'é', 1},
+		{'\u0301', 0},
+		{'你', 2},
+		{'한', 2},
+		{'ｱ', 1},
+		{'Ａ', 2},
+		{'😀', 2},
+	}
+
+	for _, test := range tests {
+		if width := runeWidth(test.r); width != test.expected {
+			t.Errorf("runeWidth(%q) wrong. expected=%d, got=%d", test.r, test.expected, width)
+		}
+	}
+}
+
+func TestEditorCompletion(t *testing.T) {
+	complete := func(word string) []string {
+		return completions(word, []string{"counter", "count"})
+	}
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"wh\t (x)\r", "while (x)"},
+		{"coun\t\r", "count"},
+		{"print(coun\t)\r", "print(count)"},
+		{"counte\t\r", "counter"},
+		{"zz\t\r", "zz"},
+		{"\t\r", ""},
+	}
+
+	for _, test := range tests {
+		e := testEditor(test.keys)
+		e.Complete = complete
+
+		line, err := e.edit(func() {}, 0)
+		if err != nil {
+			t.Errorf("keys %q returned error: %s", test.keys, err)
+			continue
+		}
+		if line != test.expected {
+			t.Errorf("keys %q wrong. expected=%q, got=%q", test.keys, test.expected, line)
+		}
+	}
+
+	e := testEditor("co\t\r")
+	e.Complete = complete
+	e.edit(func() {}, 0)
+	output := e.out.(*bytes.Buffer).String()
+	if !strings.Contains(output, "continue  count  counter") {
+		t.Errorf("candidates not listed, got=%q", output)
+	}
+}
+
+func TestEditorHistoryFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amoeba-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, HistoryFile)
+
+	e := testEditor("let a = 1;\r\r\x1b[A\rlet b = 2;\r")
+	if err := e.LoadHistory(path); err != nil {
+		t.Fatalf("LoadHistory returned error: %s", err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := e.edit(func() {}, 0); err != nil {
+			t.Fatalf("edit returned error: %s", err)
+		}
+	}
+
+	// blank lines and repeats of the previous line are left out
+	expected := []string{"let a = 1;", "let b = 2;"}
+
+	reloaded := testEditor("")
+	if err := reloaded.LoadHistory(path); err != nil {
+		t.Fatalf("LoadHistory returned error: %s", err)
+	}
+	if !reflect.DeepEqual(reloaded.History(), expected) {
+		t.Errorf("history wrong. expected=%q, got=%q", expected, reloaded.History())
+	}
+}
+
+func TestEditorPlainInput(t *testing.T) {
+	e := NewEditor(strings.NewReader("first\nsecond"), &bytes.Buffer{})
+	prompts := 0
+	prompt := func() { prompts++ }
+
+	for _, expected := range []string{"first", "second"} {
+		line, err := e.ReadLine(prompt, 0)
+		if err != nil {
+			t.Fatalf("ReadLine returned error: %s", err)
+		}
+		if line != expected {
+			t.Errorf("line wrong. expected=%q, got=%q", expected, line)
+		}
+	}
+
+	if _, err := e.ReadLine(prompt, 0); err != io.EOF {
+		t.Errorf("expected io.EOF, got=%v", err)
+	}
+	if prompts != 3 {
+		t.Errorf("prompt shown %d times, expected 3", prompts)
+	}
+}
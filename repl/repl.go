@@ -1,65 +1,148 @@
 package repl
 
 import (
-	"bufio"
-	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"os"
 	"os/user"
+	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
 	"github.com/ASteinheiser/amoeba-interpreter/color"
+	"github.com/ASteinheiser/amoeba-interpreter/engine"
 	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/format"
 	"github.com/ASteinheiser/amoeba-interpreter/lexer"
 	"github.com/ASteinheiser/amoeba-interpreter/object"
 	"github.com/ASteinheiser/amoeba-interpreter/parser"
+	"github.com/ASteinheiser/amoeba-interpreter/resolver"
+	"github.com/ASteinheiser/amoeba-interpreter/token"
 )
 
-// Start will start a new amoeba REPL
-func Start(in io.Reader, out io.Writer) {
-	env := object.NewEnvironment()
+// session is the state built up by the lines typed into the REPL,
+// which :reset throws away
+type session struct {
+	engineName string
+	opts       evaluator.Options
+	env        engine.Engine
+	names      *resolver.Resolver
+}
 
-	filePath := flag.String("file", "", "file path to read from")
-	flag.Parse()
+func newSession(engineName string, opts evaluator.Options) (*session, error) {
+	s := &session{engineName: engineName, opts: opts}
+	return s, s.reset()
+}
 
-	if *filePath != "" {
-		data, err := ioutil.ReadFile(*filePath)
-		if err != nil {
-			fmt.Println("File reading error:", err)
-			return
+// reset starts the session over with nothing defined
+func (s *session) reset() error {
+	env, err := engine.New(s.engineName, s.opts)
+	if err != nil {
+		return err
+	}
+
+	s.env = env
+	s.names = resolver.New()
+	return nil
+}
+
+// HistoryFile is where the lines typed into the REPL are kept,
+// relative to the home directory of the user
+const HistoryFile = ".amoeba_history"
+
+// promptWidth is the number of columns both prompts take up
+const promptWidth = 17
+
+// Start will start a new amoeba REPL, running what is typed
+// with the engine called engineName and opts
+func Start(in io.Reader, out io.Writer, engineName string, opts evaluator.Options) error {
+	// programs print where the REPL does, unless opts say otherwise
+	if opts.Out == nil {
+		opts.Out = out
+	}
+
+	s, err := newSession(engineName, opts)
+	if err != nil {
+		return err
+	}
+
+	user, err := user.Current()
+	if err != nil {
+		return err
+	}
+
+	showWelcomeMessage(user)
+
+	editor := NewEditor(in, out)
+	editor.Complete = func(word string) []string {
+		return completions(word, s.env.Names())
+	}
+	if home, err := os.UserHomeDir(); err == nil && editor.Interactive() {
+		if err := editor.LoadHistory(filepath.Join(home, HistoryFile)); err != nil {
+			fmt.Fprintln(out, "Could not load history:", err)
+		}
+	}
+
+	// input collects lines until their brackets and strings are closed
+	input := ""
+
+	for {
+		prompt := ShowPrompt
+		if input != "" {
+			prompt = ShowContinuationPrompt
 		}
 
-		evaluateProgram(string(data), out, env)
-	} else {
-		user, err := user.Current()
+		line, err := editor.ReadLine(prompt, promptWidth)
+		if err == ErrInterrupted {
+			input = ""
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			panic(err)
+			return err
 		}
 
-		showWelcomeMessage(user)
+		if input == "" && (line == "exit" || line == "quit") {
+			return nil
+		}
+		if input == "" && strings.HasPrefix(line, ":") {
+			runCommand(s, line, out)
+			continue
+		}
 
-		scanner := bufio.NewScanner(in)
+		input += line + "\n"
+		if !inputComplete(input) {
+			continue
+		}
 
-		for {
-			ShowPrompt()
-			scanned := scanner.Scan()
-			if !scanned {
-				return
-			}
+		evaluateProgram(lexer.New(input), out, s.env, s.names)
+		input = ""
+	}
+}
 
-			line := scanner.Text()
-			if line == "exit" || line == "quit" {
-				return
-			}
+// completions returns the keywords, builtins and names
+// that start with word, sorted and without duplicates
+func completions(word string, names []string) []string {
+	seen := make(map[string]bool)
+	var matches []string
 
-			evaluateProgram(line, out, env)
+	for _, list := range [][]string{token.Keywords(), evaluator.BuiltinNames(), names} {
+		for _, candidate := range list {
+			if strings.HasPrefix(candidate, word) && !seen[candidate] {
+				seen[candidate] = true
+				matches = append(matches, candidate)
+			}
 		}
 	}
+
+	sort.Strings(matches)
+	return matches
 }
 
-func evaluateProgram(input string, out io.Writer, env *object.Environment) {
-	l := lexer.New(input)
+func evaluateProgram(l *lexer.Lexer, out io.Writer, env engine.Engine, names *resolver.Resolver) {
 	p := parser.New(l)
 
 	program := p.ParseProgram()
@@ -68,14 +151,36 @@ func evaluateProgram(input string, out io.Writer, env *object.Environment) {
 		return
 	}
 
-	evaluated := evaluator.Eval(program, env)
+	// undefined names would only fail once the line using them runs,
+	// so they stop the program up front, the rest are just warnings
+	diagnostics := names.Resolve(program)
+	if printDiagnostics(out, diagnostics) {
+		return
+	}
+
+	evaluated := env.Run(program)
 	if evaluated != nil {
 		io.WriteString(out, "\n")
-		io.WriteString(out, evaluated.Inspect())
+		io.WriteString(out, show(evaluated))
 		io.WriteString(out, "\n\n")
 	}
 }
 
+// show returns a value the way the REPL shows it, which is the way
+// print writes it apart from functions, which go through the formatter
+func show(obj object.Object) string {
+	switch fn := obj.(type) {
+	case *object.Function:
+		return format.Node(&ast.FunctionLiteral{Parameters: fn.Parameters, Body: fn.Body})
+	case *object.Closure:
+		if fn.Fn.Body != nil {
+			return format.Node(&ast.FunctionLiteral{Parameters: fn.Fn.Parameters, Body: fn.Fn.Body})
+		}
+	}
+
+	return object.Pretty(obj, object.DefaultWidth)
+}
+
 // ShowPrompt prints out the symbols in the amoeba REPL
 // directly before where the user types
 func ShowPrompt() {
@@ -86,6 +191,38 @@ func ShowPrompt() {
 	color.ResetColor()
 }
 
+// ShowContinuationPrompt prints out the prompt for the
+// next line of input that isn't complete yet
+func ShowContinuationPrompt() {
+	color.ChangeColor(color.Magenta, false, color.Black, false)
+	fmt.Print(`           `)
+	color.ChangeColor(color.White, true, color.Black, false)
+	fmt.Print(" ...  ")
+	color.ResetColor()
+}
+
+// inputComplete reports whether input is ready to be evaluated, or
+// whether it has brackets, a string or a comment that later lines have
+// to close. Extra closing brackets count as complete, for the parser
+// to report
+func inputComplete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE, token.LPAREN, token.LBRACKET, token.TEMPLATE_HEAD:
+			depth++
+		case token.RBRACE, token.RPAREN, token.RBRACKET, token.TEMPLATE_TAIL:
+			depth--
+		case token.UNTERMINATED_STRING, token.UNTERMINATED_COMMENT:
+			return false
+		}
+	}
+
+	return depth <= 0
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	io.WriteString(out, "\n  Oops! Looks like your syntax has an issue...\n")
 	io.WriteString(out, "    parser errors:\n\n")
@@ -97,6 +234,26 @@ func printParserErrors(out io.Writer, errors []string) {
 	color.ResetColor()
 }
 
+// printDiagnostics prints the problems the resolver found, reporting
+// whether any of them are errors
+func printDiagnostics(out io.Writer, diagnostics []resolver.Diagnostic) bool {
+	hasErrors := false
+
+	for _, d := range diagnostics {
+		if d.IsError() {
+			hasErrors = true
+			color.Foreground(color.Red, false)
+			io.WriteString(out, "  error: "+d.String()+"\n")
+		} else {
+			color.Foreground(color.Yellow, false)
+			io.WriteString(out, "  warning: "+d.String()+"\n")
+		}
+		color.ResetColor()
+	}
+
+	return hasErrors
+}
+
 func showWelcomeMessage(user *user.User) {
 	color.ChangeColor(color.None, false, color.Black, false)
 	fmt.Print("                                                 ")
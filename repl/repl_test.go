@@ -0,0 +1,38 @@
+package repl
+
+import "testing"
+
+func TestInputComplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"", true},
+		{"let x = 5;\n", true},
+		{"let f = fn(x) {\n", false},
+		{"let f = fn(x) {\n  x * 2\n", false},
+		{"let f = fn(x) {\n  x * 2\n};\n", true},
+		{"let a = [1,\n", false},
+		{"let a = [1,\n2]\n", true},
+		{"add(1,\n", false},
+		{"let h = {\"a\": [1, 2],\n", false},
+		{"let s = \"multi\n", false},
+		{"let s = \"multi\nline\"\n", true},
+		{"let s = \"{\"\n", true},
+		{"let s = \"${fn(x) {\n", false},
+		{"let s = \"${fn(x) {\n x }(1)}\"\n", true},
+		{"let s = \"${\n", false},
+		{"let s = \"${1}\"\n", true},
+		{"x }\n", true},
+		{"let x = 1; /* more\n", false},
+		{"let x = 1; /* more\nto come */\n", true},
+		{"let f = fn(x) { // {\n", false},
+		{"let x = 1; // {\n", true},
+	}
+
+	for _, test := range tests {
+		if complete := inputComplete(test.input); complete != test.expected {
+			t.Errorf("inputComplete(%q) wrong. expected=%t, got=%t", test.input, test.expected, complete)
+		}
+	}
+}
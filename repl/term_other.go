@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package repl
+
+import "errors"
+
+// isTerminal reports whether fd is a terminal, which line editing
+// isn't supported for on this platform
+func isTerminal(fd uintptr) bool { return false }
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
+
+func terminalWidth(fd uintptr) int { return 0 }
@@ -0,0 +1,290 @@
+// Package resolver checks the names used by a program before it runs,
+// reporting undefined names, unused lets and lets that shadow builtins
+package resolver
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/token"
+)
+
+// Kind is the kind of problem a Diagnostic reports
+type Kind int
+
+const (
+	// Undefined is a name that no scope declares and that isn't a builtin,
+	// which would fail with "identifier not found" when it runs
+	Undefined Kind = iota
+	// Unused is a let inside a function that is never read
+	Unused
+	// ShadowedBuiltin is a let or parameter with the name of a builtin
+	ShadowedBuiltin
+	// UsedBeforeLet is a name used by the function or program declaring
+	// it before its let has run, when no outer scope declares it either
+	UsedBeforeLet
+)
+
+// Diagnostic is a single problem found in a program
+type Diagnostic struct {
+	Kind Kind
+	Name string
+	Pos  token.Position
+}
+
+// IsError reports whether the problem would make the program fail when
+// it runs, the other kinds are only warnings
+func (d Diagnostic) IsError() bool { return d.Kind == Undefined || d.Kind == UsedBeforeLet }
+
+// Message describes the problem without its position
+func (d Diagnostic) Message() string {
+	switch d.Kind {
+	case Undefined:
+		return "identifier not found: " + d.Name
+	case Unused:
+		return "declared and not used: " + d.Name
+	case ShadowedBuiltin:
+		return "shadows builtin function: " + d.Name
+	case UsedBeforeLet:
+		return "used before its let: " + d.Name
+	default:
+		return fmt.Sprintf("unknown problem with %s", d.Name)
+	}
+}
+
+func (d Diagnostic) String() string { return d.Pos.String() + ": " + d.Message() }
+
+// symbol is a name declared in a scope
+type symbol struct {
+	pos   token.Position // where it was first declared
+	isLet bool           // false for parameters
+	used  bool
+	set   bool // whether its let has been passed yet
+}
+
+// scope holds the names declared in a function body or the top level
+// of a program. Blocks don't get scopes of their own, the same way
+// they share the environment of the function they are in
+type scope struct {
+	outer   *scope
+	symbols map[string]*symbol
+	loops   int // how many loops the statement being resolved is in
+}
+
+// Resolver checks programs, keeping the names declared at the top level
+// between calls so that a REPL can refer to earlier lines
+type Resolver struct {
+	globals     map[string]bool
+	diagnostics []Diagnostic
+}
+
+// New creates a Resolver that only knows about builtins
+func New() *Resolver {
+	return &Resolver{globals: make(map[string]bool)}
+}
+
+// Declare adds globals that were defined some other way,
+// like by a host program embedding the interpreter
+func (r *Resolver) Declare(names ...string) {
+	for _, name := range names {
+		r.globals[name] = true
+	}
+}
+
+// Resolve checks a program, returning its problems sorted by position.
+// A let is visible everywhere in the function that declares it, so a
+// function can call another one that is only declared after it
+func (r *Resolver) Resolve(program *ast.Program) []Diagnostic {
+	r.diagnostics = nil
+
+	top := &scope{symbols: make(map[string]*symbol)}
+	r.declareLets(top, program)
+	for _, s := range program.Statements {
+		r.resolve(top, s)
+	}
+
+	// lets at the top level are left alone even when they aren't read,
+	// since later REPL lines or files importing this one can use them
+	for name := range top.symbols {
+		r.globals[name] = true
+	}
+
+	sort.SliceStable(r.diagnostics, func(i, j int) bool {
+		a, b := r.diagnostics[i].Pos, r.diagnostics[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return r.diagnostics
+}
+
+func (r *Resolver) report(kind Kind, name string, pos token.Position) {
+	r.diagnostics = append(r.diagnostics, Diagnostic{Kind: kind, Name: name, Pos: pos})
+}
+
+// declare adds a name to a scope, warning when it hides a builtin
+func (r *Resolver) declare(s *scope, name *ast.Identifier, isLet bool) {
+	if evaluator.IsBuiltin(name.Value) {
+		r.report(ShadowedBuiltin, name.Value, name.Pos())
+	}
+
+	if _, ok := s.symbols[name.Value]; !ok {
+		s.symbols[name.Value] = &symbol{pos: name.Pos(), isLet: isLet}
+	}
+}
+
+// lookup finds the innermost declaration of a name
+func (r *Resolver) lookup(s *scope, name string) (*symbol, bool) {
+	for ; s != nil; s = s.outer {
+		if sym, ok := s.symbols[name]; ok {
+			return sym, true
+		}
+	}
+	return nil, false
+}
+
+// use checks an identifier refers to something, marking it as read
+func (r *Resolver) use(s *scope, ident *ast.Identifier, read bool) {
+	if sym, ok := r.lookup(s, ident.Value); ok {
+		if read {
+			sym.used = true
+		}
+		if r.usedBeforeLet(s, ident.Value, sym) {
+			r.report(UsedBeforeLet, ident.Value, ident.Pos())
+		}
+		return
+	}
+
+	if evaluator.IsBuiltin(ident.Value) {
+		return
+	}
+	if r.globals[ident.Value] {
+		return
+	}
+
+	r.report(Undefined, ident.Value, ident.Pos())
+}
+
+// usedBeforeLet reports whether a name is used by the scope declaring it
+// before its let, with nothing outside to find instead. Uses in loops are
+// left alone, since the let will have run the next time round
+func (r *Resolver) usedBeforeLet(s *scope, name string, sym *symbol) bool {
+	if s.symbols[name] != sym || !sym.isLet || sym.set || s.loops > 0 {
+		return false
+	}
+	if _, ok := r.lookup(s.outer, name); ok {
+		return false
+	}
+	return !evaluator.IsBuiltin(name) && !r.globals[name]
+}
+
+// declareLets declares every let in a function body, without going
+// into the bodies of functions nested inside it
+func (r *Resolver) declareLets(s *scope, node ast.Node) {
+	ast.Lets(node, func(let *ast.LetStatement) {
+		r.declare(s, let.Name, true)
+	})
+}
+
+func (r *Resolver) resolve(s *scope, node ast.Node) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			r.resolve(s, stmt)
+		}
+	case *ast.LetStatement:
+		r.resolve(s, node.Value)
+		if sym, ok := s.symbols[node.Name.Value]; ok {
+			sym.set = true
+		}
+	case *ast.ExpressionStatement:
+		r.resolve(s, node.Expression)
+	case *ast.ReturnStatement:
+		r.resolve(s, node.ReturnValue)
+	case *ast.WhileStatement:
+		s.loops++
+		r.resolve(s, node.Condition)
+		r.resolve(s, node.Body)
+		s.loops--
+	case *ast.ForStatement:
+		if node.Init != nil {
+			r.resolve(s, node.Init)
+		}
+		s.loops++
+		if node.Condition != nil {
+			r.resolve(s, node.Condition)
+		}
+		if node.Update != nil {
+			r.resolve(s, node.Update)
+		}
+		r.resolve(s, node.Body)
+		s.loops--
+	case *ast.Identifier:
+		r.use(s, node, true)
+	case *ast.PrefixExpression:
+		r.resolve(s, node.Right)
+	case *ast.InfixExpression:
+		r.resolve(s, node.Left)
+		r.resolve(s, node.Right)
+	case *ast.AssignExpression:
+		if ident, ok := node.Target.(*ast.Identifier); ok {
+			// plain assignment only writes, compound assignment reads too
+			r.use(s, ident, node.Operator != "=")
+		} else {
+			r.resolve(s, node.Target)
+		}
+		r.resolve(s, node.Value)
+	case *ast.UpdateExpression:
+		// like compound assignment, it reads the target too
+		r.resolve(s, node.Target)
+	case *ast.IfExpression:
+		r.resolve(s, node.Condition)
+		r.resolve(s, node.Consequence)
+		if node.Alternative != nil {
+			r.resolve(s, node.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		r.resolveFunction(s, node)
+	case *ast.CallExpression:
+		r.resolve(s, node.Function)
+		for _, arg := range node.Arguments {
+			r.resolve(s, arg)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			r.resolve(s, el)
+		}
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			r.resolve(s, pair.Key)
+			r.resolve(s, pair.Value)
+		}
+	case *ast.TemplateLiteral:
+		for _, exp := range node.Expressions {
+			r.resolve(s, exp)
+		}
+	case *ast.IndexExpression:
+		r.resolve(s, node.Left)
+		r.resolve(s, node.Index)
+	}
+}
+
+func (r *Resolver) resolveFunction(outer *scope, fn *ast.FunctionLiteral) {
+	s := &scope{outer: outer, symbols: make(map[string]*symbol)}
+
+	for _, param := range fn.Parameters {
+		r.declare(s, param, false)
+	}
+	r.declareLets(s, fn.Body)
+	r.resolve(s, fn.Body)
+
+	for name, sym := range s.symbols {
+		if sym.isLet && !sym.used && name != "_" {
+			r.report(Unused, name, sym.pos)
+		}
+	}
+}
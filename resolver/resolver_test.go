@@ -0,0 +1,122 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+)
+
+func testResolve(t *testing.T, r *Resolver, input string) []string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	diagnostics := []string{}
+	for _, d := range r.Resolve(program) {
+		diagnostics = append(diagnostics, d.String())
+	}
+	return diagnostics
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 5; x + 1", []string{}},
+		{"len([1, 2])", []string{}},
+		{"y + 1", []string{"1:1: identifier not found: y"}},
+		{
+			"let f = fn(x) { if (x > 10) { retrn x }; x };",
+			[]string{"1:31: identifier not found: retrn"},
+		},
+		{"z = 1", []string{"1:1: identifier not found: z"}},
+		{"let a = [1]; a[b] = 2", []string{"1:16: identifier not found: b"}},
+		// lets are visible everywhere in their function, like the
+		// compiler's hoisting, so functions can refer to later ones
+		{
+			"let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };\n" +
+				"let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };",
+			[]string{},
+		},
+		{
+			"let f = fn() { let unused = 1; let used = 2; used };",
+			[]string{"1:20: declared and not used: unused"},
+		},
+		{
+			"let f = fn() { let x = 1; x = 2; };",
+			[]string{"1:20: declared and not used: x"},
+		},
+		{"let f = fn() { let x = 1; x += 2; };", []string{}},
+		{"let f = fn() { let x = 1; x++; };", []string{}},
+		{"++y", []string{"1:3: identifier not found: y"}},
+		{"let f = fn() { let _ = 1; };", []string{}},
+		{"let unusedAtTopLevel = 1;", []string{}},
+		{
+			"let f = fn() { let g = fn() { count }; let count = 0; g() };",
+			[]string{},
+		},
+		{
+			"let len = fn(x) { 0 };\nlet f = fn(print) { print };",
+			[]string{"1:5: shadows builtin function: len", "2:12: shadows builtin function: print"},
+		},
+		{
+			"let f = fn() { while (true) { let i = 0; i += 1; break; } };\n" +
+				"for (let j = 0; j < 3; j += 1) { k }",
+			[]string{"2:34: identifier not found: k"},
+		},
+		{`let m = import "m.amoeba"; m["x"]`, []string{}},
+		{`let n = 1; "${n} and ${nn}"`, []string{"1:24: identifier not found: nn"}},
+		{
+			"let f = fn() { let v = if (true) { let w = 1; w } else { 2 }; v };",
+			[]string{},
+		},
+		{"print(x); let x = 1;", []string{"1:7: used before its let: x"}},
+		{"let y = y + 1;", []string{"1:9: used before its let: y"}},
+		{"let f = fn() { g = 1; let g = 2; g };", []string{"1:16: used before its let: g"}},
+		// a let inside a function can still fall back on an outer one
+		{"let a = 1; let f = fn() { let b = a; let a = 2; a + b };", []string{}},
+		{"let f = fn() { x }; let x = 1; f()", []string{}},
+		{"let i = 0; while (i < 2) { if (i > 0) { z }; let z = i; i++ }", []string{}},
+	}
+
+	for _, test := range tests {
+		diagnostics := testResolve(t, New(), test.input)
+
+		if len(diagnostics) != len(test.expected) {
+			t.Errorf("wrong diagnostics for %q. expected=%q, got=%q", test.input, test.expected, diagnostics)
+			continue
+		}
+		for i, expected := range test.expected {
+			if diagnostics[i] != expected {
+				t.Errorf("wrong diagnostic for %q. expected=%q, got=%q", test.input, expected, diagnostics[i])
+			}
+		}
+	}
+}
+
+func TestResolverKeepsGlobals(t *testing.T) {
+	r := New()
+	r.Declare("host")
+
+	if diagnostics := testResolve(t, r, "let x = host;"); len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %q", diagnostics)
+	}
+
+	if diagnostics := testResolve(t, r, "x + host"); len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics: %q", diagnostics)
+	}
+
+	// an earlier line's x is still there until the let runs again
+	if diagnostics := testResolve(t, r, "print(x); let x = 2;"); len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics: %q", diagnostics)
+	}
+
+	diagnostics := testResolve(t, r, "y")
+	if len(diagnostics) != 1 || diagnostics[0] != "1:1: identifier not found: y" {
+		t.Errorf("wrong diagnostics. got=%q", diagnostics)
+	}
+}
@@ -28,3 +28,43 @@ echo ""
 echo -e "${BlackBG}${BCyan}Evaluator Test Results:${NoColor}"
 go test ./evaluator/
 echo ""
+
+echo -e "${BlackBG}${BCyan}Object Test Results:${NoColor}"
+go test ./object/
+echo ""
+
+echo -e "${BlackBG}${BCyan}Resolver Test Results:${NoColor}"
+go test ./resolver/
+echo ""
+
+echo -e "${BlackBG}${BCyan}Bytecode Test Results:${NoColor}"
+go test ./code/
+echo ""
+
+echo -e "${BlackBG}${BCyan}Compiler Test Results:${NoColor}"
+go test ./compiler/
+echo ""
+
+echo -e "${BlackBG}${BCyan}VM Test Results:${NoColor}"
+go test ./vm/
+echo ""
+
+echo -e "${BlackBG}${BCyan}Embedding API Test Results:${NoColor}"
+go test ./amoeba/
+echo ""
+
+echo -e "${BlackBG}${BCyan}REPL Test Results:${NoColor}"
+go test ./repl/
+echo ""
+
+echo -e "${BlackBG}${BCyan}Format Test Results:${NoColor}"
+go test ./format/
+echo ""
+
+echo -e "${BlackBG}${BCyan}Style Test Results:${NoColor}"
+go test ./style/
+echo ""
+
+echo -e "${BlackBG}${BCyan}CLI Test Results:${NoColor}"
+go test ./cli/
+echo ""
@@ -0,0 +1,63 @@
+// Package style holds the parts of how Amoeba source is written that the
+// formatter and the printing of values share, so that values look the way
+// they would in a formatted program
+package style
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Indent is what each level of nesting is indented by
+const Indent = "  "
+
+// Width is the number of columns code and values are fitted into
+// before they are broken up over several lines
+const Width = 80
+
+// Quote returns s as a string literal, with escape sequences for the
+// characters that can't be written as they are
+func Quote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	Escape(&out, s)
+	out.WriteByte('"')
+	return out.String()
+}
+
+// Escape writes s to out as the inside of a string literal, with escape
+// sequences for the characters that can't be written as they are
+func Escape(out *strings.Builder, s string) {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case r == utf8.RuneError && size == 1:
+			// bytes that aren't UTF-8 can only be kept as they are
+			out.WriteByte(s[i])
+		case r == '"':
+			out.WriteString(`\"`)
+		case r == '\\':
+			out.WriteString(`\\`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == 0:
+			out.WriteString(`\0`)
+		case r == '$' && strings.HasPrefix(s[i+1:], "{"):
+			// otherwise it would start an interpolation
+			out.WriteString(`\$`)
+		case unicode.IsPrint(r):
+			out.WriteRune(r)
+		default:
+			fmt.Fprintf(out, `\u{%X}`, r)
+		}
+
+		i += size
+	}
+}
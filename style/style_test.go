@@ -0,0 +1,24 @@
+package style
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain", `"plain"`},
+		{"say \"hi\"\\", `"say \"hi\"\\"`},
+		{"line\none\ttab\r\x00", `"line\none\ttab\r\0"`},
+		{"${x} $y", `"\${x} $y"`},
+		{"é😀", `"é😀"`},
+		{"\u200b\x7f", `"\u{200B}\u{7F}"`},
+		{"\xff", "\"\xff\""},
+	}
+
+	for _, test := range tests {
+		if quoted := Quote(test.input); quoted != test.expected {
+			t.Errorf("Quote(%q) wrong. expected=%s, got=%s", test.input, test.expected, quoted)
+		}
+	}
+}
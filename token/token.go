@@ -1,9 +1,47 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 // Token is a single element
 type Token struct {
 	Type    Type
 	Literal string
+	Pos     Position
+}
+
+// Comment is a // line comment or /* */ block comment. The lexer skips
+// over comments, keeping them aside for tools such as the formatter
+type Comment struct {
+	Text string // the whole comment, including the // or /* */
+	Pos  Position
+}
+
+// Position is the location of a token in the source code
+type Position struct {
+	Filename string
+	Line     int // starts at 1
+	Column   int // starts at 1, counted in bytes
+}
+
+// IsValid reports whether the position has a line number
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String returns the position formatted as file:line:col,
+// leaving off the file name when there isn't one
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 // Type is the type of token
@@ -18,14 +56,47 @@ const (
 	IDENT = "IDENT"
 	// INT : integer literal
 	INT = "INT"
+	// FLOAT : floating-point number literal
+	FLOAT = "FLOAT"
 	// TRUE : boolean literal for true
 	TRUE = "true"
 	// FALSE : boolean literal for false
 	FALSE = "false"
 	// STRING : string literal
 	STRING = "STRING"
+	// TEMPLATE_HEAD : start of a string with interpolations, up to the first ${
+	TEMPLATE_HEAD = "TEMPLATE_HEAD"
+	// TEMPLATE_MIDDLE : part of a string between the } of one
+	// interpolation and the ${ of the next
+	TEMPLATE_MIDDLE = "TEMPLATE_MIDDLE"
+	// TEMPLATE_TAIL : end of a string with interpolations, from the
+	// } of the last one to the closing quote
+	TEMPLATE_TAIL = "TEMPLATE_TAIL"
+	// RAW_STRING : string literal between backticks, taken as it is
+	RAW_STRING = "RAW_STRING"
+	// UNTERMINATED_STRING : string literal missing its closing quote
+	UNTERMINATED_STRING = "UNTERMINATED_STRING"
+	// INVALID_ESCAPE : escape sequence in a string literal that
+	// doesn't exist, such as \q, which comes just before the string
+	INVALID_ESCAPE = "INVALID_ESCAPE"
+	// UNTERMINATED_COMMENT : block comment missing its closing */
+	UNTERMINATED_COMMENT = "UNTERMINATED_COMMENT"
 	// ASSIGN : sets an identifier equal to a literal
 	ASSIGN = "="
+	// PLUS_ASSIGN : adds to an existing value
+	PLUS_ASSIGN = "+="
+	// MINUS_ASSIGN : subtracts from an existing value
+	MINUS_ASSIGN = "-="
+	// ASTERISK_ASSIGN : multiplies an existing value
+	ASTERISK_ASSIGN = "*="
+	// INCREMENT : adds one to an existing value
+	INCREMENT = "++"
+	// DECREMENT : subtracts one from an existing value
+	DECREMENT = "--"
+	// SLASH_ASSIGN : divides an existing value
+	SLASH_ASSIGN = "/="
+	// PERCENT_ASSIGN : takes the remainder of an existing value
+	PERCENT_ASSIGN = "%="
 	// PLUS : adds two integers
 	PLUS = "+"
 	// BANG : inverts an expression
@@ -36,10 +107,22 @@ const (
 	SLASH = "/"
 	// ASTERISK : multiplies two numbers
 	ASTERISK = "*"
+	// PERCENT : remainder of dividing two numbers
+	PERCENT = "%"
 	// LT : checks if a number is less than another
 	LT = "<"
 	// GT : checks if a number is greater than another
 	GT = ">"
+	// LT_EQ : checks if a number is less than or equal to another
+	LT_EQ = "<="
+	// GT_EQ : checks if a number is greater than or equal to another
+	GT_EQ = ">="
+	// AND : checks if both values are truthy, only looking
+	// at the second when the first is
+	AND = "&&"
+	// OR : checks if either value is truthy, only looking
+	// at the second when the first isn't
+	OR = "||"
 	// EQ : checks if two values are equal
 	EQ = "=="
 	// NOT_EQ : checks if two values are NOT equal
@@ -75,16 +158,44 @@ const (
 	// RETURN : exits a function and returns a value
 	// to the caller
 	RETURN = "return"
+	// WHILE : repeats a block while a condition is true
+	WHILE = "while"
+	// FOR : repeats a block with an initializer,
+	// condition and update step
+	FOR = "for"
+	// BREAK : exits the innermost loop
+	BREAK = "break"
+	// CONTINUE : skips to the next iteration of
+	// the innermost loop
+	CONTINUE = "continue"
+	// IMPORT : evaluates another file and returns
+	// a hash of its top-level bindings
+	IMPORT = "import"
 )
 
 var keywords = map[string]Type{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"import":   IMPORT,
+}
+
+// Keywords returns the reserved words of the language, sorted
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
 }
 
 // LookupIdent returns the token type for a
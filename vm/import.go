@@ -0,0 +1,35 @@
+package vm
+
+import (
+	"github.com/ASteinheiser/amoeba-interpreter/ast"
+	"github.com/ASteinheiser/amoeba-interpreter/compiler"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+)
+
+// importModule imports the file at path through the modules of the
+// run, compiling and running it in its own VM that shares the limits of
+// this one. written is the path as it appears in the import, for errors
+func (vm *VM) importModule(path, written string) object.Object {
+	return vm.opts.Modules.Import(path, written, func(program *ast.Program) (object.Object, func(string) (object.Object, bool)) {
+		symbols := compiler.NewSymbolTable()
+		comp := compiler.NewWithState(symbols)
+		if err := comp.Compile(program); err != nil {
+			return newError("could not compile %q: %s", written, err), nil
+		}
+
+		globals := &object.Scope{}
+		imported := NewWithGlobals(comp.Bytecode(), globals)
+		imported.opts, imported.builtins = vm.opts, vm.builtins
+		imported.ctx, imported.steps = vm.ctx, vm.steps
+		imported.depth = vm.depth + len(vm.frames) - 1
+		result := imported.run()
+
+		return result, func(name string) (object.Object, bool) {
+			slot, ok := symbols.Resolve(name)
+			if !ok || globals.Slots[slot] == nil {
+				return nil, false
+			}
+			return globals.Slots[slot], true
+		}
+	})
+}
@@ -0,0 +1,476 @@
+// Package vm executes bytecode produced by the compiler on a stack machine
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ASteinheiser/amoeba-interpreter/code"
+	"github.com/ASteinheiser/amoeba-interpreter/compiler"
+	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/token"
+)
+
+// StackSize is the number of values the stack starts out with room for
+const StackSize = 2048
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpGreaterThan:  ">",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterEqual: ">=",
+}
+
+// Frame is a single call of a closure
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+	scope       *object.Scope
+	callSite    token.Position // where the closure was called from
+	loops       []int          // stack heights of the loops being run
+
+	// origin is the first frame replaced by tail calls ending up in this
+	// one, kept so that traces match the evaluator's
+	origin *object.StackFrame
+}
+
+// VM runs compiled programs
+type VM struct {
+	main     *object.CompiledFunction
+	globals  *object.Scope
+	opts     evaluator.Options
+	builtins map[string]*object.Builtin
+	ctx      context.Context
+	steps    *int64 // instructions run, shared with the vms of imported files
+	depth    int    // calls nested in the vms of the files importing this one
+
+	stack []object.Object
+	sp    int // always points to the next free slot, the top of the stack is stack[sp-1]
+
+	frames []*Frame
+}
+
+// New creates a VM that runs bytecode with empty globals
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobals(bytecode, &object.Scope{})
+}
+
+// NewWithGlobals creates a VM that runs bytecode with existing globals,
+// which must have been compiled with the same compiler.SymbolTable
+func NewWithGlobals(bytecode *compiler.Bytecode, globals *object.Scope) *VM {
+	for len(globals.Slots) < bytecode.NumGlobals {
+		globals.Slots = append(globals.Slots, nil)
+	}
+
+	return &VM{
+		main:    bytecode.Main,
+		globals: globals,
+		stack:   make([]object.Object, StackSize),
+	}
+}
+
+// Run runs the program, returning the value of its last statement the
+// same way evaluator.Eval does, or the *object.Error it failed with
+func (vm *VM) Run() object.Object {
+	return vm.RunWithOptions(context.Background(), evaluator.Options{})
+}
+
+// RunWithOptions runs the program like Run, changing how it runs the
+// same way evaluator.EvalWithOptions does. Steps are counted in
+// instructions rather than nodes, so the same MaxSteps allows a
+// program more work on the vm
+func (vm *VM) RunWithOptions(ctx context.Context, opts evaluator.Options) object.Object {
+	ctx, opts, cancel := evaluator.Prepare(ctx, opts)
+	defer cancel()
+
+	vm.ctx = ctx
+	vm.opts = opts
+	vm.builtins = evaluator.Builtins(opts.Out)
+	vm.steps = new(int64)
+
+	return vm.run()
+}
+
+// run runs the program with the options already set
+func (vm *VM) run() object.Object {
+	vm.sp = 0
+	vm.frames = []*Frame{{
+		cl:    &object.Closure{Fn: vm.main},
+		scope: vm.globals,
+	}}
+
+	for {
+		frame := vm.frames[len(vm.frames)-1]
+		fn := frame.cl.Fn
+		ins := fn.Instructions
+
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+		frame.ip++
+
+		if err := vm.step(); err != nil {
+			return vm.fail(err, frame, ip)
+		}
+
+		var result object.Object
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.push(fn.Constants[constIndex])
+
+		case code.OpTrue:
+			vm.push(evaluator.TRUE)
+
+		case code.OpFalse:
+			vm.push(evaluator.FALSE)
+
+		case code.OpNull:
+			vm.push(evaluator.NULL)
+
+		case code.OpNothing:
+			vm.push(nil)
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+
+		case code.OpDup2:
+			vm.push(vm.stack[vm.sp-2])
+			vm.push(vm.stack[vm.sp-2])
+
+		case code.OpBury:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+
+			top := vm.stack[vm.sp-1]
+			copy(vm.stack[vm.sp-n:vm.sp], vm.stack[vm.sp-n-1:vm.sp-1])
+			vm.stack[vm.sp-n-1] = top
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpEqual,
+			code.OpNotEqual, code.OpLessThan, code.OpGreaterThan, code.OpLessEqual, code.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.pop()
+			result = evaluator.EvalInfix(infixOperators[op], left, right, vm.opts.CheckedArithmetic)
+
+		case code.OpMinus:
+			result = evaluator.EvalPrefix("-", vm.pop(), vm.opts.CheckedArithmetic)
+
+		case code.OpBang:
+			result = evaluator.EvalPrefix("!", vm.pop(), vm.opts.CheckedArithmetic)
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[ip+1:]))
+
+		case code.OpJumpNotTruthy:
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = int(code.ReadUint16(ins[ip+1:]))
+			}
+
+		case code.OpLoopEnter:
+			frame.loops = append(frame.loops, vm.sp)
+
+		case code.OpLoopExit:
+			frame.loops = frame.loops[:len(frame.loops)-1]
+
+		case code.OpLoopJump:
+			vm.sp = frame.loops[len(frame.loops)-1]
+			frame.ip = int(code.ReadUint16(ins[ip+1:]))
+
+		case code.OpGetName:
+			ref := fn.Refs[code.ReadUint16(ins[ip+1:])]
+			frame.ip += 2
+			result = vm.getName(frame.scope, ref)
+
+		case code.OpSetName:
+			ref := fn.Refs[code.ReadUint16(ins[ip+1:])]
+			frame.ip += 2
+			if !setName(frame.scope, ref, vm.stack[vm.sp-1]) {
+				result = newError("identifier not found: " + ref.Name)
+			}
+
+		case code.OpDefine:
+			slot := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			frame.scope.Slots[slot] = vm.pop()
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+
+			vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			numPairs := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			result = vm.buildHash(numPairs)
+
+		case code.OpInterpolate:
+			numValues := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			var out strings.Builder
+			for _, val := range vm.stack[vm.sp-numValues : vm.sp] {
+				if val == nil {
+					val = evaluator.NULL
+				}
+				out.WriteString(val.Inspect())
+			}
+			vm.sp -= numValues
+
+			vm.push(&object.String{Value: out.String()})
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			result = evaluator.EvalIndex(left, index)
+
+		case code.OpSetIndex:
+			val := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			result = evaluator.EvalIndexAssignment(left, index, val)
+
+		case code.OpCall, code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			tail := op == code.OpTailCall && len(vm.frames) > 1
+			result = vm.call(numArgs, fn.CallSites[ip], tail)
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if len(vm.frames) == 1 {
+				return returnValue
+			}
+
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.sp = frame.basePointer
+			vm.push(returnValue)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			compiled := fn.Constants[constIndex].(*object.CompiledFunction)
+			vm.push(&object.Closure{Fn: compiled, Scope: frame.scope})
+
+		case code.OpImport:
+			path := fn.Constants[code.ReadUint16(ins[ip+1:])].(*object.String).Value
+			written := fn.Constants[code.ReadUint16(ins[ip+3:])].(*object.String).Value
+			frame.ip += 4
+			result = vm.importModule(path, written)
+
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return newError("%s", err)
+			}
+			return newError("unhandled opcode %s", def.Name)
+		}
+
+		if result == nil {
+			continue
+		}
+		if err, ok := result.(*object.Error); ok {
+			return vm.fail(err, frame, ip)
+		}
+		vm.push(result)
+	}
+}
+
+// step counts an instruction against the step limit, and every so
+// often checks whether the context is done
+func (vm *VM) step() *object.Error {
+	*vm.steps++
+
+	if vm.opts.MaxSteps > 0 && *vm.steps > vm.opts.MaxSteps {
+		return evaluator.StepLimitError(vm.opts.MaxSteps)
+	}
+
+	if *vm.steps%evaluator.ContextCheckInterval == 0 {
+		if err := vm.ctx.Err(); err != nil {
+			return evaluator.ContextError(err)
+		}
+	}
+
+	return nil
+}
+
+// fail tags an error with the position of the instruction it came from,
+// unless it already has one, and with every call it unwinds through
+func (vm *VM) fail(err *object.Error, frame *Frame, ip int) *object.Error {
+	if !err.Pos.IsValid() {
+		err.Pos = frame.cl.Fn.Positions[ip]
+	}
+
+	for i := len(vm.frames) - 1; i > 0; i-- {
+		err.Trace = append(err.Trace, object.StackFrame{
+			Function: vm.frames[i].cl.Fn.Name,
+			Pos:      vm.frames[i].callSite,
+		})
+		if origin := vm.frames[i].origin; origin != nil {
+			err.Trace = append(err.Trace, *origin)
+		}
+	}
+
+	return err
+}
+
+// call calls the function below the arguments on the stack, a tail call
+// of a closure replaces the current frame instead of adding one
+func (vm *VM) call(numArgs int, callSite token.Position, tail bool) object.Object {
+	basePointer := vm.sp - numArgs - 1
+	args := vm.stack[basePointer+1 : vm.sp]
+
+	switch callee := vm.stack[basePointer].(type) {
+	case *object.Closure:
+		if numArgs < callee.Fn.NumParameters {
+			return newError("wrong number of arguments: want=%d, got=%d",
+				callee.Fn.NumParameters, numArgs)
+		}
+		// frames other than the first are calls, tail calls replace one
+		nested := vm.depth + len(vm.frames) - 1
+		if !tail && vm.opts.MaxDepth > 0 && nested >= vm.opts.MaxDepth {
+			return evaluator.DepthLimitError(vm.opts.MaxDepth)
+		}
+
+		scope := &object.Scope{
+			Slots:  make([]object.Object, callee.Fn.NumSlots),
+			Parent: callee.Scope,
+		}
+		copy(scope.Slots, args[:callee.Fn.NumParameters])
+
+		frame := &Frame{
+			cl:          callee,
+			basePointer: basePointer,
+			scope:       scope,
+			callSite:    callSite,
+		}
+
+		if tail {
+			current := vm.frames[len(vm.frames)-1]
+			frame.basePointer = current.basePointer
+			frame.origin = current.origin
+			if frame.origin == nil {
+				frame.origin = &object.StackFrame{Function: current.cl.Fn.Name, Pos: current.callSite}
+			}
+			vm.frames[len(vm.frames)-1] = frame
+		} else {
+			vm.frames = append(vm.frames, frame)
+		}
+		vm.sp = frame.basePointer
+
+		return nil
+
+	case *object.Builtin:
+		argsCopy := make([]object.Object, numArgs)
+		copy(argsCopy, args)
+		vm.sp = basePointer
+
+		// a call always has a value, even when a builtin gives none
+		if result := callee.Fn(argsCopy...); result != nil {
+			return result
+		}
+		return evaluator.NULL
+
+	default:
+		return newError("not a function: %s", callee.Type())
+	}
+}
+
+// getName returns the value of the first scope in ref that has one,
+// falling back to builtins like evaluator does
+func (vm *VM) getName(scope *object.Scope, ref code.Ref) object.Object {
+	for _, slot := range ref.Slots {
+		if val := lookup(scope, slot); val != nil {
+			return val
+		}
+	}
+
+	if builtin, ok := vm.builtins[ref.Name]; ok {
+		return builtin
+	}
+
+	return newError("identifier not found: " + ref.Name)
+}
+
+// setName assigns to the first scope in ref that already has a value,
+// reporting false if there isn't one, like object.Environment.Assign
+func setName(scope *object.Scope, ref code.Ref, val object.Object) bool {
+	for _, slot := range ref.Slots {
+		s := walk(scope, slot.Depth)
+		if slot.Index < len(s.Slots) && s.Slots[slot.Index] != nil {
+			s.Slots[slot.Index] = val
+			return true
+		}
+	}
+
+	return false
+}
+
+func lookup(scope *object.Scope, slot code.Slot) object.Object {
+	s := walk(scope, slot.Depth)
+	if slot.Index >= len(s.Slots) {
+		return nil
+	}
+	return s.Slots[slot.Index]
+}
+
+func walk(scope *object.Scope, depth int) *object.Scope {
+	for i := 0; i < depth; i++ {
+		scope = scope.Parent
+	}
+	return scope
+}
+
+func (vm *VM) buildHash(numPairs int) object.Object {
+	hash := object.NewHash()
+	start := vm.sp - numPairs*2
+
+	for i := start; i < vm.sp; i += 2 {
+		key, ok := vm.stack[i].(object.Hashable)
+		if !ok {
+			return newError("invalid hash key: %s", vm.stack[i].Type())
+		}
+		hash.Set(key, vm.stack[i+1])
+	}
+	vm.sp = start
+
+	return hash
+}
+
+func (vm *VM) push(obj object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	obj := vm.stack[vm.sp-1]
+	vm.sp--
+	return obj
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
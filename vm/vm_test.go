@@ -0,0 +1,217 @@
+package vm
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ASteinheiser/amoeba-interpreter/compiler"
+	"github.com/ASteinheiser/amoeba-interpreter/evaluator"
+	"github.com/ASteinheiser/amoeba-interpreter/lexer"
+	"github.com/ASteinheiser/amoeba-interpreter/object"
+	"github.com/ASteinheiser/amoeba-interpreter/parser"
+)
+
+func testRun(input string) object.Object {
+	return testRunWithOptions(input, evaluator.Options{})
+}
+
+func testRunWithOptions(input string, opts evaluator.Options) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &object.Error{Message: "parser errors: " + strings.Join(p.Errors(), ", ")}
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: "compiler error: " + err.Error()}
+	}
+
+	return New(comp.Bytecode()).RunWithOptions(context.Background(), opts)
+}
+
+func TestGlobalsPersistBetweenRuns(t *testing.T) {
+	symbols := compiler.NewSymbolTable()
+	globals := &object.Scope{}
+
+	inputs := []string{
+		"let f = fn() { later * 2 }",
+		"let later = 21",
+		"f()",
+	}
+
+	var result object.Object
+	for _, input := range inputs {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+
+		comp := compiler.NewWithState(symbols)
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		result = NewWithGlobals(comp.Bytecode(), globals).Run()
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok {
+		t.Fatalf("result not of type *object.Integer, got=%T (%+v)", result, result)
+	}
+	if integer.Value != 42 {
+		t.Errorf("result has wrong value. expected=42, got=%d", integer.Value)
+	}
+}
+
+func TestDeepRecursion(t *testing.T) {
+	input := "let count = fn(n) { if (n == 0) { return 0 } 1 + count(n - 1) }; count(50000)"
+
+	// calls don't nest on the Go stack, so the vm can go as deep as it is allowed
+	result := testRunWithOptions(input, evaluator.Options{Limits: evaluator.Limits{MaxDepth: 100000}})
+
+	integer, ok := result.(*object.Integer)
+	if !ok {
+		t.Fatalf("result not of type *object.Integer, got=%T (%+v)", result, result)
+	}
+	if integer.Value != 50000 {
+		t.Errorf("result has wrong value. expected=50000, got=%d", integer.Value)
+	}
+}
+
+func TestWrongNumberOfArguments(t *testing.T) {
+	result := testRun("let f = fn(a, b) { a + b }; f(1)")
+
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("result not of type *object.Error, got=%T (%+v)", result, result)
+	}
+
+	expected := "ERROR: 1:30: wrong number of arguments: want=2, got=1"
+	if errObj.Inspect() != expected {
+		t.Errorf("errObj.Inspect() wrong. expected=%q, got=%q", expected, errObj.Inspect())
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   evaluator.Limits
+		limit    object.Limit
+		expected string
+	}{
+		{
+			"let f = fn() { f() }; f()",
+			evaluator.Limits{},
+			object.DepthLimit,
+			"call depth limit exceeded: more than 10000 nested calls",
+		},
+		{
+			"let f = fn(n) { if (n > 0) { 1 + f(n - 1) } }; f(20)",
+			evaluator.Limits{MaxDepth: 10},
+			object.DepthLimit,
+			"call depth limit exceeded: more than 10 nested calls",
+		},
+		{
+			"while (true) {}",
+			evaluator.Limits{MaxSteps: 1000},
+			object.StepLimit,
+			"step limit exceeded: more than 1000 steps",
+		},
+		{
+			"while (true) {}",
+			evaluator.Limits{Timeout: time.Millisecond},
+			object.ContextLimit,
+			"evaluation stopped: context deadline exceeded",
+		},
+		{
+			// calls in imported files count on top of the ones importing them
+			`let f = fn(n) { if (n > 0) { f(n - 1) } else { import "../evaluator/testdata/deep.amoeba" } }; f(5)`,
+			evaluator.Limits{MaxDepth: 8},
+			object.DepthLimit,
+			"call depth limit exceeded: more than 8 nested calls",
+		},
+	}
+
+	for _, test := range tests {
+		result := testRunWithOptions(test.input, evaluator.Options{Limits: test.limits})
+
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("result not of type *object.Error for %q, got=%T (%+v)", test.input, result, result)
+			continue
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("errObj.Message wrong. expected=%q, got=%q", test.expected, errObj.Message)
+		}
+		if errObj.Limit != test.limit {
+			t.Errorf("errObj.Limit wrong. expected=%q, got=%q", test.limit, errObj.Limit)
+		}
+	}
+}
+
+func TestExecutionContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	p := parser.New(lexer.New("while (true) {}"))
+	comp := compiler.New()
+	if err := comp.Compile(p.ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	result := New(comp.Bytecode()).RunWithOptions(ctx, evaluator.Options{})
+
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("result not of type *object.Error, got=%T (%+v)", result, result)
+	}
+	if errObj.Limit != object.ContextLimit {
+		t.Errorf("errObj.Limit wrong. expected=%q, got=%q", object.ContextLimit, errObj.Limit)
+	}
+}
+
+func TestTailCallsReuseFrames(t *testing.T) {
+	// deeper than any limit on nested calls, which tail calls don't add to
+	input := "let count = fn(n, acc) { if (n == 0) { return acc } return count(n - 1, acc + 1) }; count(100000, 0)"
+
+	result := testRun(input)
+
+	integer, ok := result.(*object.Integer)
+	if !ok {
+		t.Fatalf("result not of type *object.Integer, got=%T (%+v)", result, result)
+	}
+	if integer.Value != 100000 {
+		t.Errorf("result has wrong value. expected=100000, got=%d", integer.Value)
+	}
+}
+
+func TestLoopsRestoreStackHeight(t *testing.T) {
+	inputs := []string{
+		"let i = 0; while (i < 10) { i += 1; if (i == 5) { break } }; i",
+		"let n = 0; for (let i = 0; i < 10; i++) { [1, 2, if (i < 5) { continue }]; n += 1 }; n",
+		"let f = fn() { let n = 0; while (true) { n += [1, if (n > 3) { return n }][0] } }; [f(), f()]",
+		"let n = 0; for (let i = 0; i < 3; i++) { for (let j = 0; j < 3; j++) { if (j == 1) { break }; n += [j][0] + 1 } }; n",
+	}
+
+	for _, input := range inputs {
+		p := parser.New(lexer.New(input))
+		comp := compiler.New()
+		if err := comp.Compile(p.ParseProgram()); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		machine := New(comp.Bytecode())
+		if result, ok := machine.Run().(*object.Error); ok {
+			t.Errorf("%q failed: %s", input, result.Inspect())
+			continue
+		}
+
+		// break, continue and return leave whatever the loop body had
+		// pushed behind, which the loop has to drop
+		if machine.sp != 0 {
+			t.Errorf("%q left %d values on the stack", input, machine.sp)
+		}
+	}
+}